@@ -0,0 +1,176 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// The reasons a session token is rejected for.
+var (
+	ErrNoToken        = errors.New("winter: no session token")
+	ErrMalformedToken = errors.New("winter: malformed session token")
+	ErrUnknownKey     = errors.New("winter: no key for the issuer, subject and kid of the token")
+	ErrAlgorithm      = errors.New("winter: unexpected signing algorithm")
+	ErrSignature      = errors.New("winter: invalid token signature")
+	ErrExpired        = errors.New("winter: token has expired")
+	ErrNotYetValid    = errors.New("winter: token is not valid yet")
+	ErrIssuedInFuture = errors.New("winter: token is issued in the future")
+	ErrIssuer         = errors.New("winter: token is issued by an unexpected issuer")
+	ErrAudience       = errors.New("winter: token is issued for another audience")
+)
+
+var errUnboundSession = errors.New("winter: session is not bound to a request")
+
+// Authentication is the outcome of authenticating the token of a request.
+// Err is the reason the token was rejected, nil when it was accepted.
+type Authentication struct {
+	Token  string
+	Source string
+	Claims *jwt.StandardClaims
+	Err    error
+}
+
+// Valid reports whether the token was accepted.
+func (authentication *Authentication) Valid() bool {
+	return authentication != nil && authentication.Err == nil
+}
+
+// A rejected authentication is an Exception answered with 401
+// Unauthorized.
+
+func (authentication *Authentication) Error() string {
+	return authentication.Err.Error()
+}
+
+func (authentication *Authentication) Unwrap() error {
+	return authentication.Err
+}
+
+func (authentication *Authentication) Status() int {
+	return http.StatusUnauthorized
+}
+
+// Authenticate verifies the token of the request the handler serves. The
+// outcome is kept for Authentication.
+func (handler *Handler) Authenticate() bool {
+	handler.authentication = handler.verify()
+	return handler.authentication.Valid()
+}
+
+// Authentication returns the outcome of the last call to Authenticate, nil
+// before it is called.
+func (handler *Handler) Authentication() *Authentication {
+	return handler.authentication
+}
+
+// extract reads the token from the bearer header, the cookie and the query
+// parameter of the handler, in that order.
+func (handler *Handler) extract() (token, source string) {
+	header := handler.Header
+	if header == "" {
+		header = "Authorization"
+	}
+	value := handler.request.Header.Get(header)
+	if len(value) > 7 && strings.EqualFold(value[:7], "Bearer ") {
+		return strings.TrimSpace(value[7:]), "header"
+	}
+	if handler.Cookie != "" {
+		if cookie, err := handler.request.Cookie(handler.Cookie); err == nil && cookie.Value != "" {
+			return cookie.Value, "cookie"
+		}
+	}
+	if handler.Query != "" {
+		if value := handler.request.URL.Query().Get(handler.Query); value != "" {
+			return value, "query"
+		}
+	}
+	return "", ""
+}
+
+func (handler *Handler) verify() *Authentication {
+	if handler.request == nil {
+		return &Authentication{Err: errUnboundSession}
+	}
+	authentication := new(Authentication)
+	authentication.Token, authentication.Source = handler.extract()
+	if authentication.Token == "" {
+		authentication.Err = ErrNoToken
+		return authentication
+	}
+
+	claims := new(jwt.StandardClaims)
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	_, err := parser.ParseWithClaims(authentication.Token, claims, func(token *jwt.Token) (interface{}, error) {
+		id, _ := token.Header["kid"].(string)
+		name := strings.Join([]string{claims.Issuer, claims.Subject}, ":")
+		signingKey := handler.keys().VerificationKey(name, id)
+		if signingKey == nil {
+			return nil, ErrUnknownKey
+		}
+		if _, accepted := algorithms(signingKey); accepted[token.Method.Alg()] == nil {
+			return nil, ErrAlgorithm
+		}
+		return verificationKey(signingKey), nil
+	})
+	if err != nil {
+		authentication.Err = reason(err)
+		return authentication
+	}
+	authentication.Claims = claims
+	authentication.Err = handler.validate(claims, time.Now())
+	return authentication
+}
+
+// reason maps the errors of the parser to the reasons a token is rejected
+// for.
+func reason(err error) error {
+	validationError, ok := err.(*jwt.ValidationError)
+	if !ok {
+		return ErrMalformedToken
+	}
+	switch {
+	case validationError.Inner == ErrAlgorithm, validationError.Inner == ErrUnknownKey:
+		return validationError.Inner
+	case validationError.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+		return ErrSignature
+	}
+	return ErrMalformedToken
+}
+
+// validate checks the times of the claims, allowing for the skew of the
+// handler, and their issuer and audience.
+func (handler *Handler) validate(claims *jwt.StandardClaims, now time.Time) error {
+	skew := int64(handler.Skew / time.Second)
+	unix := now.Unix()
+	switch {
+	case claims.ExpiresAt != 0 && unix-skew >= claims.ExpiresAt:
+		return ErrExpired
+	case claims.NotBefore != 0 && unix+skew < claims.NotBefore:
+		return ErrNotYetValid
+	case claims.IssuedAt != 0 && unix+skew < claims.IssuedAt:
+		return ErrIssuedInFuture
+	case handler.Issuer != "" && claims.Issuer != handler.Issuer:
+		return ErrIssuer
+	case handler.Audience != "" && !claims.VerifyAudience(handler.Audience, true):
+		return ErrAudience
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rrborja/winter/metadata"
+)
+
+// DefaultBodyLimit is the largest request body a route accepts unless it
+// declares another limit with @maxbody.
+const DefaultBodyLimit = 10 << 20
+
+var (
+	fileHeaderType  = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeadersType = reflect.TypeOf([]*multipart.FileHeader(nil))
+)
+
+// BodyError reports a request body that could not be decoded into the
+// parameter annotated with @body. Code is 400 for a malformed body, 413
+// for one over the limit of the route and 415 for an unsupported
+// Content-Type.
+type BodyError struct {
+	Code int
+	Err  error
+}
+
+func (err *BodyError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *BodyError) Unwrap() error {
+	return err.Err
+}
+
+func (err *BodyError) Status() int {
+	return err.Code
+}
+
+// bodyOptions are read from the directives of a route: @maxbody 1MB
+// changes the limit of the body and @strict rejects the fields of a JSON,
+// XML or form body that the target does not declare.
+type bodyOptions struct {
+	limit  int64
+	strict bool
+}
+
+func newBodyOptions(directives []*metadata.DirectiveInfo) (bodyOptions, error) {
+	options := bodyOptions{limit: DefaultBodyLimit}
+	for _, directive := range directives {
+		switch directive.Name {
+		case "maxbody":
+			if len(directive.Arguments) != 1 {
+				return options, errors.New("@maxbody expects a size such as 512KB")
+			}
+			limit, err := parseSize(directive.Arguments[0])
+			if err != nil {
+				return options, fmt.Errorf("@maxbody: %v", err)
+			}
+			options.limit = limit
+		case "strict":
+			options.strict = true
+			if len(directive.Arguments) > 0 {
+				strict, err := strconv.ParseBool(directive.Arguments[0])
+				if err != nil {
+					return options, fmt.Errorf("@strict: %v", err)
+				}
+				options.strict = strict
+			}
+		}
+	}
+	return options, nil
+}
+
+func parseSize(size string) (int64, error) {
+	units := []struct {
+		suffix string
+		scale  int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+
+	upper := strings.ToUpper(size)
+	for _, unit := range units {
+		if strings.HasSuffix(upper, unit.suffix) {
+			n, err := strconv.ParseInt(upper[:len(upper)-len(unit.suffix)], 10, 64)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid size %q", size)
+			}
+			return n * unit.scale, nil
+		}
+	}
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	return n, nil
+}
+
+// HasBody reports whether the request carries a body. Parameters of
+// pointer type annotated with @body are left nil when it does not.
+func (arguments *Arguments) HasBody() bool {
+	req := arguments.request
+	return req != nil && req.Body != nil && req.Body != http.NoBody && req.ContentLength != 0
+}
+
+// Body decodes the request body into target according to its
+// Content-Type: JSON, XML, URL-encoded or multipart forms.
+func (arguments *Arguments) Body(target interface{}) error {
+	if !arguments.HasBody() {
+		return &BodyError{http.StatusBadRequest, errors.New("missing request body")}
+	}
+	req := arguments.request
+	options := bodyOptions{limit: DefaultBodyLimit}
+	if arguments.route != nil {
+		options = arguments.route.body
+	}
+
+	contentType := req.Header.Get("Content-Type")
+	if contentType == "" {
+		return &BodyError{http.StatusUnsupportedMediaType, errors.New("missing Content-Type")}
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return &BodyError{http.StatusUnsupportedMediaType, err}
+	}
+
+	req.Body = http.MaxBytesReader(nil, req.Body, options.limit)
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		decoder := json.NewDecoder(req.Body)
+		if options.strict {
+			decoder.DisallowUnknownFields()
+		}
+		err = decoder.Decode(target)
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		err = decodeXML(req.Body, target, options.strict)
+	case mediaType == "application/x-www-form-urlencoded":
+		if err = req.ParseForm(); err == nil {
+			err = decodeForm(req.PostForm, nil, target, options.strict)
+		}
+	case mediaType == "multipart/form-data":
+		if err = req.ParseMultipartForm(options.limit); err == nil {
+			err = decodeForm(req.MultipartForm.Value, req.MultipartForm.File, target, options.strict)
+		}
+	default:
+		return &BodyError{http.StatusUnsupportedMediaType, fmt.Errorf("unsupported Content-Type %s", mediaType)}
+	}
+
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return &BodyError{http.StatusRequestEntityTooLarge, fmt.Errorf("request body exceeds %d bytes", tooLarge.Limit)}
+		}
+		if err == io.EOF {
+			err = errors.New("missing request body")
+		}
+		return &BodyError{http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err)}
+	}
+	return nil
+}
+
+// decodeBody binds a parameter of type T or *T annotated with @body. The
+// pointer is left nil when the request has no body.
+func decodeBody(arguments *Arguments, typ reflect.Type) (reflect.Value, error) {
+	if typ.Kind() == reflect.Ptr {
+		if !arguments.HasBody() {
+			return reflect.Zero(typ), nil
+		}
+		pointer := reflect.New(typ.Elem())
+		return pointer, arguments.Body(pointer.Interface())
+	}
+	pointer := reflect.New(typ)
+	return pointer.Elem(), arguments.Body(pointer.Interface())
+}
+
+type formField struct {
+	name    string
+	index   []int
+	convert conversion
+}
+
+var formFields sync.Map
+
+// fields lists the struct fields a form binds to, by their form tag or
+// their name, with the conversion of their type.
+func fields(typ reflect.Type) ([]formField, error) {
+	if cached, ok := formFields.Load(typ); ok {
+		return cached.([]formField), nil
+	}
+
+	var list []formField
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name := field.Tag.Get("form")
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		var convert conversion
+		if field.Type != fileHeaderType && field.Type != fileHeadersType {
+			var err error
+			if convert, err = converter(field.Type); err != nil {
+				return nil, fmt.Errorf("field %s: %v", field.Name, err)
+			}
+		}
+		list = append(list, formField{name, field.Index, convert})
+	}
+
+	formFields.Store(typ, list)
+	return list, nil
+}
+
+func decodeForm(values url.Values, files map[string][]*multipart.FileHeader, target interface{}, strict bool) error {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("cannot decode a form into %T", target)
+	}
+	value = value.Elem()
+
+	list, err := fields(value.Type())
+	if err != nil {
+		return err
+	}
+
+	valueKeys := keys(values)
+	fileKeys := make([]string, 0, len(files))
+	for key := range files {
+		fileKeys = append(fileKeys, key)
+	}
+	sort.Strings(fileKeys)
+
+	known := make(map[string]bool, len(values)+len(files))
+	for _, field := range list {
+		target := value.FieldByIndex(field.index)
+
+		if field.convert == nil {
+			key, ok := formKey(field.name, fileKeys)
+			if !ok {
+				continue
+			}
+			known[key] = true
+			if target.Type() == fileHeaderType {
+				target.Set(reflect.ValueOf(files[key][0]))
+			} else {
+				target.Set(reflect.ValueOf(files[key]))
+			}
+			continue
+		}
+
+		key, ok := formKey(field.name, valueKeys)
+		if !ok {
+			continue
+		}
+		known[key] = true
+		converted, err := field.convert(&Arguments{Query: url.Values{field.name: values[key]}}, field.name)
+		if err != nil {
+			return err
+		}
+		target.Set(converted)
+	}
+
+	if strict {
+		for _, key := range append(valueKeys, fileKeys...) {
+			if !known[key] {
+				return fmt.Errorf("unknown field %q", key)
+			}
+		}
+	}
+	return nil
+}
+
+func keys(values url.Values) []string {
+	list := make([]string, 0, len(values))
+	for key := range values {
+		list = append(list, key)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// formKey finds the key of a field, preferring an exact match over a
+// case-insensitive one as encoding/json does.
+func formKey(name string, keys []string) (string, bool) {
+	for _, key := range keys {
+		if key == name {
+			return key, true
+		}
+	}
+	for _, key := range keys {
+		if strings.EqualFold(key, name) {
+			return key, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,124 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rrborja/winter/metadata"
+	"github.com/stretchr/testify/assert"
+)
+
+type signup struct {
+	Name   string `form:"name"`
+	Age    uint8
+	Avatar *multipart.FileHeader `form:"avatar"`
+}
+
+func bodyArguments(contentType, body string, options bodyOptions) *Arguments {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	if options.limit == 0 {
+		options.limit = DefaultBodyLimit
+	}
+	return &Arguments{request: req, route: &route{body: options}}
+}
+
+func TestBodyForm(t *testing.T) {
+	var target signup
+	err := bodyArguments("application/x-www-form-urlencoded", "name=Ada&age=36", bodyOptions{}).Body(&target)
+	assert.NoError(t, err)
+	assert.Equal(t, signup{Name: "Ada", Age: 36}, target)
+
+	err = bodyArguments("application/x-www-form-urlencoded", "age=old", bodyOptions{}).Body(&target)
+	assert.EqualError(t, err, `invalid request body: invalid value "old" for :Age: expected uint8 (invalid syntax)`)
+	assert.Equal(t, 400, err.(*BodyError).Status())
+
+	err = bodyArguments("application/x-www-form-urlencoded", "name=Ada&admin=true", bodyOptions{strict: true}).Body(&target)
+	assert.EqualError(t, err, `invalid request body: unknown field "admin"`)
+}
+
+type shipment struct {
+	ID      string `xml:"id,attr"`
+	Address address
+	Items   []struct {
+		SKU string `xml:"sku,attr"`
+		Qty int    `xml:"qty"`
+	} `xml:"items>item"`
+	Notes []string `xml:"note"`
+}
+
+func TestBodyStrictXML(t *testing.T) {
+	body := `<shipment id="7" xmlns="urn:winter"><Address><street>Elm</street></Address>` +
+		`<items><item sku="a"><qty>2</qty></item></items><note>fragile</note></shipment>`
+	var target shipment
+	err := bodyArguments("application/xml", body, bodyOptions{strict: true}).Body(&target)
+	assert.NoError(t, err)
+	assert.Equal(t, "Elm", target.Address.Street)
+	assert.Equal(t, 2, target.Items[0].Qty)
+
+	for body, message := range map[string]string{
+		`<shipment><admin>true</admin></shipment>`:                           `unknown element <admin> in <shipment>`,
+		`<shipment owner="ann"></shipment>`:                                  `unknown attribute "owner" of <shipment>`,
+		`<shipment><Address><zip>0150</zip></Address></shipment>`:            `unknown element <zip> in <Address>`,
+		`<shipment><Address><street a="1">Elm</street></Address></shipment>`: `unknown attribute "a" of <street>`,
+	} {
+		err := bodyArguments("application/xml", body, bodyOptions{strict: true}).Body(new(shipment))
+		assert.EqualError(t, err, "invalid request body: "+message, body)
+		assert.NoError(t, bodyArguments("application/xml", body, bodyOptions{}).Body(new(shipment)), body)
+	}
+}
+
+func TestBodyMultipart(t *testing.T) {
+	var buffer bytes.Buffer
+	writer := multipart.NewWriter(&buffer)
+	writer.WriteField("name", "Ada")
+	file, _ := writer.CreateFormFile("avatar", "ada.png")
+	file.Write([]byte("png"))
+	writer.Close()
+
+	var target signup
+	err := bodyArguments(writer.FormDataContentType(), buffer.String(), bodyOptions{}).Body(&target)
+	assert.NoError(t, err)
+	assert.Equal(t, "Ada", target.Name)
+	assert.Equal(t, "ada.png", target.Avatar.Filename)
+}
+
+func TestBodyOptions(t *testing.T) {
+	options, err := newBodyOptions(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, bodyOptions{limit: DefaultBodyLimit}, options)
+
+	options, err = newBodyOptions(directives(t, "//> @maxbody 512KB", "//> @strict"))
+	assert.NoError(t, err)
+	assert.Equal(t, bodyOptions{limit: 512 << 10, strict: true}, options)
+
+	_, err = newBodyOptions(directives(t, "//> @maxbody lots"))
+	assert.EqualError(t, err, `@maxbody: invalid size "lots"`)
+}
+
+func directives(t *testing.T, annotations ...string) []*metadata.DirectiveInfo {
+	list := make([]*metadata.DirectiveInfo, len(annotations))
+	for i, annotation := range annotations {
+		meta, err := metadata.ParseMetadata(annotation)
+		assert.NoError(t, err)
+		list[i] = meta.Info.(*metadata.DirectiveInfo)
+	}
+	return list
+}
@@ -0,0 +1,485 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"net/textproto"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/rrborja/winter/metadata"
+)
+
+const (
+	winterImportPath = "github.com/rrborja/winter"
+	defaultOutput    = "winter_routes_gen.go"
+)
+
+func gen(args []string) error {
+	flags := flag.NewFlagSet("gen", flag.ContinueOnError)
+	source := flags.String("source", "", "module root to scan (default: nearest directory with a go.mod)")
+	output := flags.String("o", defaultOutput, "file to write")
+	tags := flags.String("tags", "", "comma-separated build tags")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(*output))
+	if err != nil {
+		return err
+	}
+
+	root := *source
+	if root == "" {
+		if root, err = moduleRoot(dir); err != nil {
+			return err
+		}
+	}
+
+	src := new(metadata.Source)
+	if *tags != "" {
+		src.BuildTags = strings.Split(*tags, ",")
+	}
+	if err := src.LoadSourceCode(root); err != nil {
+		return err
+	}
+	if src.Module == "" {
+		return fmt.Errorf("%s has no go.mod", root)
+	}
+
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return err
+	}
+
+	code, err := generate(src, packageName(dir, filepath.Base(*output)), path.Join(src.Module, filepath.ToSlash(rel)))
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(*output, code, 0644)
+}
+
+func moduleRoot(dir string) (string, error) {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.New("no go.mod found; use -source")
+		}
+		dir = parent
+	}
+}
+
+// packageName reads the package clause of the other files in dir so that
+// the generated file joins their package.
+func packageName(dir, output string) string {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, file := range files {
+		if filepath.Base(file) == output || strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.PackageClauseOnly)
+		if err == nil {
+			return f.Name.Name
+		}
+	}
+	return "main"
+}
+
+type generator struct {
+	bytes.Buffer
+	pkgPath string
+	imports map[string]string
+	aliases map[string]bool
+	build   build.Context
+	checked map[string]*checkedPackage
+}
+
+func generate(src *metadata.Source, pkgName, pkgPath string) ([]byte, error) {
+	methods := append([]*metadata.ControllerMethodDescriptor(nil), src.ControllerMethods...)
+	sort.SliceStable(methods, func(i, j int) bool {
+		a, b := methods[i], methods[j]
+		if a.Package != b.Package {
+			return a.Package < b.Package
+		}
+		if a.Controller != b.Controller {
+			return a.Controller < b.Controller
+		}
+		return a.Name < b.Name
+	})
+
+	g := &generator{
+		pkgPath: pkgPath,
+		imports: map[string]string{winterImportPath: "winter"},
+		aliases: map[string]bool{"winter": true},
+		build:   build.Default,
+		checked: make(map[string]*checkedPackage),
+	}
+	g.build.BuildTags = append(append([]string(nil), g.build.BuildTags...), src.BuildTags...)
+
+	var body bytes.Buffer
+	for _, method := range methods {
+		if err := g.route(&body, method); err != nil {
+			return nil, fmt.Errorf("%s: %v", method.Position, err)
+		}
+	}
+
+	fmt.Fprintf(g, "// Code generated by winter gen. DO NOT EDIT.\n\npackage %s\n\nimport (\n", pkgName)
+	paths := make([]string, 0, len(g.imports))
+	for importPath := range g.imports {
+		paths = append(paths, importPath)
+	}
+	sort.Strings(paths)
+	for _, importPath := range paths {
+		fmt.Fprintf(g, "\t%s %q\n", g.imports[importPath], importPath)
+	}
+	fmt.Fprintf(g, ")\n\nfunc init() {\n\twinter.Register(\n%s\t)\n}\n", body.Bytes())
+
+	return format.Source(g.Bytes())
+}
+
+func (g *generator) qualify(pkg, name string) (string, error) {
+	if pkg == g.pkgPath {
+		return name, nil
+	}
+	if !token.IsExported(name) {
+		return "", fmt.Errorf("%s must be exported to be referenced from %s", name, g.pkgPath)
+	}
+	return g.alias(pkg) + "." + name, nil
+}
+
+func (g *generator) alias(pkg string) string {
+	alias, ok := g.imports[pkg]
+	if !ok {
+		base := strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+				return r
+			}
+			return '_'
+		}, path.Base(pkg))
+		alias = base
+		for i := 2; g.aliases[alias]; i++ {
+			alias = base + strconv.Itoa(i)
+		}
+		g.imports[pkg] = alias
+		g.aliases[alias] = true
+	}
+	return alias
+}
+
+// winterType tells whether typ, as written in the controller's file, is the
+// named type of the winter package.
+func winterType(typ, name string, method *metadata.ControllerMethodDescriptor) bool {
+	expr, err := parser.ParseExpr(typ)
+	if err != nil {
+		return false
+	}
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		return expr.Name == name && (method.Package == winterImportPath || method.Imports["."] == winterImportPath)
+	case *ast.SelectorExpr:
+		pkg, ok := expr.X.(*ast.Ident)
+		return ok && expr.Sel.Name == name && method.Imports[pkg.Name] == winterImportPath
+	}
+	return false
+}
+
+// typeName rewrites a parameter type as written in the controller's file
+// into one that resolves in the generated file.
+func (g *generator) typeName(expr ast.Expr, method *metadata.ControllerMethodDescriptor) (string, error) {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		if types.Universe.Lookup(expr.Name) != nil {
+			return expr.Name, nil
+		}
+		return g.qualify(method.Package, expr.Name)
+	case *ast.SelectorExpr:
+		pkg, ok := expr.X.(*ast.Ident)
+		if !ok || method.Imports[pkg.Name] == "" {
+			return "", fmt.Errorf("unresolved type %s", types.ExprString(expr))
+		}
+		return g.alias(method.Imports[pkg.Name]) + "." + expr.Sel.Name, nil
+	case *ast.StarExpr:
+		elem, err := g.typeName(expr.X, method)
+		return "*" + elem, err
+	default:
+		return "", fmt.Errorf("unsupported type %s", types.ExprString(expr))
+	}
+}
+
+func (g *generator) route(w *bytes.Buffer, method *metadata.ControllerMethodDescriptor) error {
+	controller, err := g.qualify(method.Package, method.Controller)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "winter.CompiledRoute{\n")
+	fmt.Fprintf(w, "Package: %q,\nController: %q,\nMethod: %q,\n", method.Package, method.Controller, method.Name)
+	if method.Prefix != "" {
+		fmt.Fprintf(w, "Prefix: %q,\n", method.Prefix)
+	}
+	fmt.Fprintf(w, "Annotation: %q,\n", method.Annotation)
+	if len(method.Directives) > 0 {
+		fmt.Fprintf(w, "Directives: []string{\n")
+		for _, directive := range method.Directives {
+			fmt.Fprintf(w, "%q,\n", "//> "+directive.String())
+		}
+		fmt.Fprintf(w, "},\n")
+	}
+	fmt.Fprintf(w, "Invoke: func(controller winter.Controller, response winter.Response, arguments *winter.Arguments) ([]interface{}, error) {\n")
+
+	if method.PointerMethod {
+		fmt.Fprintf(w, "c := controller.(*%s)\n", controller)
+	} else {
+		fmt.Fprintf(w, "c, ok := controller.(%s)\nif !ok {\nc = *controller.(*%s)\n}\n", controller, controller)
+	}
+
+	parameters := make([]string, len(method.Parameters))
+	for i, name := range method.Parameters {
+		typ := method.ParameterTypes[i]
+		variable, annotated := method.Variables[name]
+
+		switch {
+		case !annotated && winterType(typ, "Response", method):
+			parameters[i] = "response"
+		case !annotated && winterType(typ, "Request", method):
+			parameters[i] = "arguments.Request()"
+		case !annotated:
+			return fmt.Errorf("parameter %s of %s.%s has no annotation", name, method.Controller, method.Name)
+		case variable.Type == metadata.Directive:
+			typ, err := parser.ParseExpr(method.ParameterTypes[i])
+			if err == nil {
+				err = g.directive(w, fmt.Sprintf("p%d", i), typ, name, variable.Info.(*metadata.DirectiveInfo), method)
+			}
+			if err != nil {
+				return fmt.Errorf("parameter %s of %s.%s: %v", name, method.Controller, method.Name, err)
+			}
+			parameters[i] = fmt.Sprintf("p%d", i)
+		case variable.Type != metadata.Variable:
+			return fmt.Errorf("parameter %s of %s.%s must be bound to a single variable", name, method.Controller, method.Name)
+		default:
+			typ, err := parser.ParseExpr(method.ParameterTypes[i])
+			if err == nil {
+				err = g.extract(w, fmt.Sprintf("p%d", i), typ, "arguments", variable.Info.(*metadata.VariableInfo).Name, method)
+			}
+			if err != nil {
+				return fmt.Errorf("parameter %s of %s.%s: %v", name, method.Controller, method.Name, err)
+			}
+			parameters[i] = fmt.Sprintf("p%d", i)
+		}
+	}
+
+	call := fmt.Sprintf("c.%s(%s)", method.Name, strings.Join(parameters, ", "))
+	if len(method.Results) == 0 {
+		fmt.Fprintf(w, "%s\nreturn nil, nil\n", call)
+	} else {
+		results := make([]string, len(method.Results))
+		for i := range results {
+			results[i] = fmt.Sprintf("r%d", i)
+		}
+		fmt.Fprintf(w, "%s := %s\nreturn []interface{}{%s}, nil\n",
+			strings.Join(results, ", "), call, strings.Join(results, ", "))
+	}
+
+	fmt.Fprintf(w, "},\n},\n")
+	return nil
+}
+
+// extract emits the statements that declare target with the given type
+// and bind it to the named variable of from, the arguments or one of their
+// sources, without resorting to reflection.
+func (g *generator) extract(w *bytes.Buffer, target string, typ ast.Expr, from, name string, method *metadata.ControllerMethodDescriptor) error {
+	const check = "if err != nil {\nreturn nil, err\n}\n"
+
+	if array, ok := typ.(*ast.ArrayType); ok && array.Len == nil {
+		if _, nested := array.Elt.(*ast.ArrayType); nested {
+			return fmt.Errorf("unsupported type %s", types.ExprString(typ))
+		}
+		elem, err := g.typeName(array.Elt, method)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s := make([]%s, %s.Len(%q))\nfor i := range %s {\n", target, elem, from, name, target)
+		if err := g.extract(w, target+"e", array.Elt, fmt.Sprintf("%s.At(%q, i)", from, name), name, method); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s[i] = %se\n}\n", target, target)
+		return nil
+	}
+
+	if star, ok := typ.(*ast.StarExpr); ok {
+		elem, err := g.typeName(star.X, method)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "var %s *%s\nif %s.Has(%q) {\n", target, elem, from, name)
+		if err := g.extract(w, target+"v", star.X, from, name, method); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s = &%sv\n}\n", target, target)
+		return nil
+	}
+
+	if ident, ok := typ.(*ast.Ident); ok {
+		switch ident.Name {
+		case "string":
+			fmt.Fprintf(w, "%s := %s.Get(%q)\n", target, from, name)
+			return nil
+		case "bool":
+			fmt.Fprintf(w, "%s, err := %s.Bool(%q)\n"+check, target, from, name)
+			return nil
+		case "int64", "uint64", "float64":
+			fmt.Fprintf(w, "%s, err := %s.%s(%q, 64)\n"+check, target, from, accessor(ident.Name), name)
+			return nil
+		case "int", "int8", "int16", "int32", "uint", "uint8", "uint16", "uint32", "uintptr", "float32":
+			fmt.Fprintf(w, "%sv, err := %s.%s(%q, %d)\n"+check, target, from, accessor(ident.Name), name, bitSize(ident.Name))
+			fmt.Fprintf(w, "%s := %s(%sv)\n", target, ident.Name, target)
+			return nil
+		}
+		if types.Universe.Lookup(ident.Name) != nil {
+			return fmt.Errorf("unsupported type %s", ident.Name)
+		}
+	}
+
+	if selector, ok := typ.(*ast.SelectorExpr); ok && selector.Sel.Name == "Duration" {
+		if pkg, ok := selector.X.(*ast.Ident); ok && method.Imports[pkg.Name] == "time" {
+			fmt.Fprintf(w, "%s, err := %s.Duration(%q)\n"+check, target, from, name)
+			return nil
+		}
+	}
+
+	// A named type of a basic kind is read as its kind and converted, like
+	// the reflection dispatcher does, unless it decodes itself from text.
+	if resolved := g.resolve(typ, method); resolved != nil && !textUnmarshaler(resolved) {
+		basic, ok := resolved.Underlying().(*types.Basic)
+		if !ok {
+			return fmt.Errorf("unsupported type %s", types.ExprString(typ))
+		}
+		qualified, err := g.typeName(typ, method)
+		if err != nil {
+			return err
+		}
+		if err := g.extract(w, target+"b", ast.NewIdent(basic.Name()), from, name, method); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s := %s(%sb)\n", target, qualified, target)
+		return nil
+	}
+
+	// Anything else has to implement encoding.TextUnmarshaler, which the
+	// compiler checks when building the generated file.
+	qualified, err := g.typeName(typ, method)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "var %s %s\nif err := %s.Text(%q, &%s); err != nil {\nreturn nil, err\n}\n",
+		target, qualified, from, name, target)
+	return nil
+}
+
+// directive emits the statements that bind target to the request body, a
+// header, a cookie or the remote address.
+func (g *generator) directive(w *bytes.Buffer, target string, typ ast.Expr, parameter string, directive *metadata.DirectiveInfo, method *metadata.ControllerMethodDescriptor) error {
+	switch directive.Name {
+	case "body":
+		return g.body(w, target, typ, method)
+	case "header":
+		name := parameter
+		if len(directive.Arguments) > 0 {
+			name = directive.Arguments[0]
+		}
+		return g.extract(w, target, typ, "arguments.Header()", textproto.CanonicalMIMEHeaderKey(name), method)
+	case "cookie":
+		name := parameter
+		if len(directive.Arguments) > 0 {
+			name = directive.Arguments[0]
+		}
+		return g.extract(w, target, typ, "arguments.Cookie()", name, method)
+	case "remote":
+		return g.extract(w, target, typ, "arguments.Remote()", "remote", method)
+	}
+	return fmt.Errorf("cannot be annotated with @%s", directive.Name)
+}
+
+// body emits the statements that decode the request body into target.
+func (g *generator) body(w *bytes.Buffer, target string, typ ast.Expr, method *metadata.ControllerMethodDescriptor) error {
+	if star, ok := typ.(*ast.StarExpr); ok {
+		elem, err := g.typeName(star.X, method)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "var %s *%s\nif arguments.HasBody() {\n%s = new(%s)\n", target, elem, target, elem)
+		fmt.Fprintf(w, "if err := arguments.Body(%s); err != nil {\nreturn nil, err\n}\n}\n", target)
+		return nil
+	}
+
+	qualified, err := g.typeName(typ, method)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "var %s %s\nif err := arguments.Body(&%s); err != nil {\nreturn nil, err\n}\n", target, qualified, target)
+	return nil
+}
+
+func accessor(typ string) string {
+	switch {
+	case strings.HasPrefix(typ, "uint"):
+		return "Uint"
+	case strings.HasPrefix(typ, "int"):
+		return "Int"
+	default:
+		return "Float"
+	}
+}
+
+// bitSizes are the sizes the typed accessors parse basic types with. int,
+// uint and uintptr take the size of the platform, as 0 tells strconv to.
+var bitSizes = map[string]int{
+	"int":     0,
+	"int8":    8,
+	"int16":   16,
+	"int32":   32,
+	"int64":   64,
+	"uint":    0,
+	"uint8":   8,
+	"uint16":  16,
+	"uint32":  32,
+	"uint64":  64,
+	"uintptr": 0,
+	"float32": 32,
+	"float64": 64,
+}
+
+func bitSize(typ string) int {
+	return bitSizes[typ]
+}
@@ -0,0 +1,424 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rrborja/winter/metadata"
+	"github.com/stretchr/testify/assert"
+)
+
+func loadTree(t *testing.T, files map[string]string) *metadata.Source {
+	root := t.TempDir()
+	for name, content := range files {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		assert.NoError(t, os.WriteFile(file, []byte(content), 0644))
+	}
+
+	src := new(metadata.Source)
+	assert.NoError(t, src.LoadSourceCode(root))
+	return src
+}
+
+const shopSource = `package customers
+
+import "github.com/rrborja/winter"
+
+type Customers struct {
+	winter.Controller
+}
+
+//> GET /customers/:id ? :verbose
+func (c *Customers) Get(
+	id uint32, //> :id
+	verbose bool, //> :verbose
+	response winter.Response,
+	request winter.Request,
+) error {
+	return nil
+}
+
+//> DELETE /customers/:name
+func (c Customers) Delete(
+	name string, //> :name
+) {
+}
+`
+
+func TestGenerateDispatchTable(t *testing.T) {
+	src := loadTree(t, map[string]string{
+		"go.mod":                 "module example.com/shop\n",
+		"customers/customers.go": shopSource,
+	})
+
+	code, err := generate(src, "main", "example.com/shop")
+	assert.NoError(t, err)
+
+	generated := string(code)
+	assert.Contains(t, generated, "// Code generated by winter gen. DO NOT EDIT.")
+	assert.Contains(t, generated, `customers "example.com/shop/customers"`)
+	assert.Contains(t, generated, `Annotation: "//> GET /customers/:id ? :verbose",`)
+	assert.Contains(t, generated, `p0v, err := arguments.Uint("id", 32)`)
+	assert.Contains(t, generated, `p0 := uint32(p0v)`)
+	assert.Contains(t, generated, `p1, err := arguments.Bool("verbose")`)
+	assert.Contains(t, generated, `r0 := c.Get(p0, p1, response, arguments.Request())`)
+	assert.Contains(t, generated, "c, ok := controller.(customers.Customers)")
+
+	again, err := generate(src, "main", "example.com/shop")
+	assert.NoError(t, err)
+	assert.Equal(t, generated, string(again))
+}
+
+func TestGenerateInControllerPackage(t *testing.T) {
+	src := loadTree(t, map[string]string{
+		"go.mod":                 "module example.com/shop\n",
+		"customers/customers.go": shopSource,
+	})
+
+	code, err := generate(src, "customers", "example.com/shop/customers")
+	assert.NoError(t, err)
+	assert.Contains(t, string(code), "c := controller.(*Customers)")
+	assert.NotContains(t, string(code), `customers "example.com/shop/customers"`)
+}
+
+func TestGenerateTypedParameters(t *testing.T) {
+	src := loadTree(t, map[string]string{
+		"go.mod": "module example.com/shop\n",
+		"orders/orders.go": `package orders
+			import (
+				"time"
+				"github.com/google/uuid"
+			)
+			type Orders winter.Controller
+			type Status string
+			//> GET /orders/:id ? :since :within :limit :status
+			func (o *Orders) List(
+				id uuid.UUID, //> :id
+				since time.Time, //> :since
+				within time.Duration, //> :within
+				limit *int, //> :limit
+				status Status, //> :status
+			) {}`,
+	})
+
+	code, err := generate(src, "main", "example.com/shop")
+	assert.NoError(t, err)
+
+	generated := string(code)
+	assert.Contains(t, generated, `uuid "github.com/google/uuid"`)
+	assert.Contains(t, generated, "var p0 uuid.UUID\n")
+	assert.Contains(t, generated, `if err := arguments.Text("since", &p1); err != nil {`)
+	assert.Contains(t, generated, `p2, err := arguments.Duration("within")`)
+	assert.Contains(t, generated, "var p3 *int\n")
+	assert.Contains(t, generated, "p3 = &p3v\n")
+	assert.Contains(t, generated, "p4b := arguments.Get(\"status\")\n")
+	assert.Contains(t, generated, "p4 := orders.Status(p4b)\n")
+}
+
+func TestGenerateBitSizes(t *testing.T) {
+	src := loadTree(t, map[string]string{
+		"go.mod": "module example.com/shop\n",
+		"rates/rates.go": `package rates
+			type Rates winter.Controller
+			//> GET /rates ? :ratio :count :small
+			func (r *Rates) List(
+				ratio float32, //> :ratio
+				count int, //> :count
+				small int8, //> :small
+			) {}`,
+	})
+
+	code, err := generate(src, "main", "example.com/shop")
+	assert.NoError(t, err)
+
+	generated := string(code)
+	assert.Contains(t, generated, `p0v, err := arguments.Float("ratio", 32)`)
+	assert.Contains(t, generated, `p1v, err := arguments.Int("count", 0)`)
+	assert.Contains(t, generated, `p2v, err := arguments.Int("small", 8)`)
+}
+
+func TestGenerateUnsupportedType(t *testing.T) {
+	src := loadTree(t, map[string]string{
+		"go.mod": "module example.com/shop\n",
+		"customers/customers.go": `package customers
+			type Customers winter.Controller
+			//> GET /customers/:id
+			func (c *Customers) Get(id complex128, //> :id
+			) {}`,
+	})
+
+	_, err := generate(src, "main", "example.com/shop")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "parameter id of Customers.Get: unsupported type complex128")
+
+	src = loadTree(t, map[string]string{
+		"go.mod": "module example.com/shop\n",
+		"customers/customers.go": `package customers
+			type Customers winter.Controller
+			type Filter struct{ Name string }
+			//> GET /customers ? :filter
+			func (c *Customers) List(filter Filter, //> :filter
+			) {}`,
+	})
+
+	_, err = generate(src, "main", "example.com/shop")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "parameter filter of Customers.List: unsupported type Filter")
+}
+
+func TestGenerateResolvesWinterTypes(t *testing.T) {
+	src := loadTree(t, map[string]string{
+		"go.mod": "module example.com/shop\n",
+		"customers/customers.go": `package customers
+			import "net/http"
+			type Customers winter.Controller
+			//> GET /customers/:id
+			func (c *Customers) Get(id string, //> :id
+				req *http.Request,
+			) {}`,
+	})
+
+	_, err := generate(src, "main", "example.com/shop")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "parameter req of Customers.Get has no annotation")
+
+	src = loadTree(t, map[string]string{
+		"go.mod": "module example.com/shop\n",
+		"customers/customers.go": `package customers
+			import web "github.com/rrborja/winter"
+			type Customers web.Controller
+			//> GET /customers/:id
+			func (c *Customers) Get(id string, //> :id
+				request web.Request,
+				response web.Response,
+			) {}`,
+	})
+
+	generated, err := generate(src, "main", "example.com/shop")
+	assert.NoError(t, err)
+	assert.Contains(t, string(generated), `c.Get(p0, arguments.Request(), response)`)
+}
+
+func TestGenerateControllerAnnotations(t *testing.T) {
+	src := loadTree(t, map[string]string{
+		"go.mod": "module example.com/shop\n",
+		"orders/orders.go": `package orders
+			//> /orders
+			//> @use Audit
+			type Orders winter.Controller
+			//> GET /:id
+			func (o *Orders) Get(
+				id string, //> :id
+			) {}`,
+	})
+
+	code, err := generate(src, "main", "example.com/shop")
+	assert.NoError(t, err)
+	assert.Regexp(t, `Prefix: +"//> /orders",`, string(code))
+	assert.Contains(t, string(code), `Annotation: "//> GET /:id",`)
+	assert.Contains(t, string(code), `Directives: []string{
+				"//> @use Audit",
+			},`)
+}
+
+func TestGenerateBodyParameter(t *testing.T) {
+	src := loadTree(t, map[string]string{
+		"go.mod": "module example.com/shop\n",
+		"orders/orders.go": `package orders
+			type Orders winter.Controller
+			type Order struct{}
+			//> POST /orders
+			//> @maxbody 64KB
+			func (o *Orders) Create(
+				order Order, //> @body
+			) {}
+			//> PUT /orders
+			func (o *Orders) Replace(
+				order *Order, //> @body
+			) {}`,
+	})
+
+	code, err := generate(src, "main", "example.com/shop")
+	assert.NoError(t, err)
+
+	generated := string(code)
+	assert.Contains(t, generated, `"//> @maxbody 64KB",`)
+	assert.Contains(t, generated, "var p0 orders.Order\n\t\t\t\tif err := arguments.Body(&p0); err != nil {")
+	assert.Contains(t, generated, "if arguments.HasBody() {\n\t\t\t\t\tp0 = new(orders.Order)\n\t\t\t\t\tif err := arguments.Body(p0); err != nil {")
+}
+
+func TestGenerateRequestParameters(t *testing.T) {
+	src := loadTree(t, map[string]string{
+		"go.mod": "module example.com/shop\n",
+		"orders/orders.go": `package orders
+			import "net"
+			type Orders winter.Controller
+			//> GET /orders
+			func (o *Orders) List(
+				requestId string, //> @header x-request-id
+				limit *int, //> @header
+				session string, //> @cookie session
+				client net.IP, //> @remote
+			) {}`,
+	})
+
+	code, err := generate(src, "main", "example.com/shop")
+	assert.NoError(t, err)
+
+	generated := string(code)
+	assert.Contains(t, generated, `p0 := arguments.Header().Get("X-Request-Id")`)
+	assert.Contains(t, generated, `if arguments.Header().Has("Limit") {`)
+	assert.Contains(t, generated, `p2 := arguments.Cookie().Get("session")`)
+	assert.Contains(t, generated, `if err := arguments.Remote().Text("remote", &p3); err != nil {`)
+}
+
+func TestGenerateSliceParameters(t *testing.T) {
+	src := loadTree(t, map[string]string{
+		"go.mod": "module example.com/shop\n",
+		"orders/orders.go": `package orders
+			type Orders winter.Controller
+			//> GET /orders ? :id :tag :page=1 :filter!
+			func (o *Orders) List(
+				ids []uint16, //> :id
+				tags []string, //> :tag
+				page int, //> :page
+				filter string, //> :filter
+			) {}`,
+	})
+
+	code, err := generate(src, "main", "example.com/shop")
+	assert.NoError(t, err)
+
+	generated := string(code)
+	assert.Contains(t, generated, `Annotation: "//> GET /orders ? :id :tag :page=1 :filter!",`)
+	assert.Contains(t, generated, `p0 := make([]uint16, arguments.Len("id"))`)
+	assert.Contains(t, generated, `p0ev, err := arguments.At("id", i).Uint("id", 16)`)
+	assert.Contains(t, generated, "p0[i] = p0e\n")
+	assert.Contains(t, generated, `p1e := arguments.At("tag", i).Get("tag")`)
+}
+
+// TestGeneratedCodeCompiles builds the generated file in a module of its
+// own, against the winter package of this tree.
+func TestGeneratedCodeCompiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a module")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go tool")
+	}
+	winterRoot, err := filepath.Abs(filepath.Join("..", ".."))
+	assert.NoError(t, err)
+	if modulePath(filepath.Join(winterRoot, "go.mod")) != winterImportPath {
+		t.Skip("the winter package is not a module to build against")
+	}
+
+	root := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/shop\n\ngo 1.21\n\nrequire github.com/rrborja/winter v0.0.0\n\n" +
+			"replace github.com/rrborja/winter => " + winterRoot + "\n",
+		"main.go": "package main\n\nfunc main() {}\n",
+		"orders/orders.go": `package orders
+
+import (
+	"time"
+
+	"github.com/rrborja/winter"
+)
+
+type Status string
+
+type Level uint8
+
+type Code string
+
+func (code *Code) UnmarshalText(text []byte) error {
+	*code = Code(text)
+	return nil
+}
+
+type Order struct {
+	Note string
+}
+
+//> /orders
+//> @maxbody 1KB
+type Orders struct {
+	winter.Controller
+}
+
+//> GET /:id ? :status :levels :ratio :since :within :code :limit
+func (o *Orders) List(
+	id uint32, //> :id
+	status Status, //> :status
+	levels []Level, //> :levels
+	ratio float32, //> :ratio
+	since time.Time, //> :since
+	within time.Duration, //> :within
+	code Code, //> :code
+	limit *int, //> :limit
+	agent string, //> @header User-Agent
+	request winter.Request,
+) error {
+	return nil
+}
+
+//> POST /
+func (o Orders) Create(
+	order *Order, //> @body
+	response winter.Response,
+) {
+}
+`,
+	}
+	for name, content := range files {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		assert.NoError(t, os.WriteFile(file, []byte(content), 0644))
+	}
+
+	src := new(metadata.Source)
+	assert.NoError(t, src.LoadSourceCode(root))
+	code, err := generate(src, "main", "example.com/shop")
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "winter_routes_gen.go"), code, 0644))
+
+	for _, command := range [][]string{{"build", "./..."}, {"vet", "./..."}} {
+		cmd := exec.Command(goTool, command...)
+		cmd.Dir = root
+		cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off", "GOSUMDB=off")
+		output, err := cmd.CombinedOutput()
+		assert.NoError(t, err, "go %s:\n%s", command[0], output)
+	}
+}
+
+func modulePath(gomod string) string {
+	content, err := os.ReadFile(gomod)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "module" {
+			return fields[1]
+		}
+	}
+	return ""
+}
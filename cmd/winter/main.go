@@ -0,0 +1,59 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command winter is the companion tool of the winter framework.
+//
+// Usage:
+//
+//	winter gen [-source dir] [-o file] [-tags list]
+//
+// gen compiles the route annotations of every controller in the module into
+// a Go file that registers them with winter.Register, so that binaries can
+// serve their routes without shipping the source code. It is meant to be
+// run from a go:generate directive:
+//
+//	//go:generate winter gen
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `usage: winter <command> [arguments]
+
+commands:
+	gen	compile route annotations into a static dispatch table
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "gen":
+		err = gen(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "winter:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rrborja/winter/metadata"
+)
+
+// checkedPackage is a package of the source, type-checked to learn what
+// the named types of its parameters are.
+type checkedPackage struct {
+	fset  *token.FileSet
+	pkg   *types.Package
+	files map[string]*ast.File
+}
+
+// resolve returns the type a parameter type of the method denotes, or nil
+// when it cannot be told, as when its package cannot be imported.
+func (g *generator) resolve(expr ast.Expr, method *metadata.ControllerMethodDescriptor) types.Type {
+	dir := filepath.Dir(method.Position.Filename)
+	checked, ok := g.checked[dir]
+	if !ok {
+		checked = g.check(dir, method.Package)
+		g.checked[dir] = checked
+	}
+	if checked == nil {
+		return nil
+	}
+	file, ok := checked.files[method.Position.Filename]
+	if !ok {
+		return nil
+	}
+	resolved, err := types.Eval(checked.fset, checked.pkg, file.Name.Pos(), types.ExprString(expr))
+	if err != nil || !resolved.IsType() || resolved.Type == types.Typ[types.Invalid] {
+		return nil
+	}
+	return resolved.Type
+}
+
+// check type-checks the package of dir. Errors, most often imports that
+// cannot be found, are left for the compiler to report.
+func (g *generator) check(dir, pkgPath string) *checkedPackage {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	checked := &checkedPackage{fset: token.NewFileSet(), files: make(map[string]*ast.File)}
+	var files []*ast.File
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if match, err := g.build.MatchFile(dir, name); err != nil || !match {
+			continue
+		}
+		filename := filepath.Join(dir, name)
+		f, err := parser.ParseFile(checked.fset, filename, nil, 0)
+		if err != nil {
+			return nil
+		}
+		checked.files[filename] = f
+		files = append(files, f)
+	}
+
+	config := &types.Config{
+		Importer: importer.ForCompiler(checked.fset, "source", nil),
+		Error:    func(error) {},
+	}
+	checked.pkg, _ = config.Check(pkgPath, checked.fset, files, nil)
+	return checked
+}
+
+// textUnmarshaler reports whether a pointer to typ has an UnmarshalText
+// method, as bound by Arguments.Text.
+func textUnmarshaler(typ types.Type) bool {
+	object, _, _ := types.LookupFieldOrMethod(types.NewPointer(typ), true, nil, "UnmarshalText")
+	_, ok := object.(*types.Func)
+	return ok
+}
@@ -0,0 +1,146 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/rrborja/winter/metadata"
+)
+
+// CompiledRoute is a route whose parameter extraction was generated ahead
+// of time by `winter gen`, so serving it needs neither the source code nor
+// reflection. Annotation holds the route annotation as written above the
+// controller method and Prefix the one above the controller type, if any.
+// Directives are the ones of the method merged with those of the controller.
+type CompiledRoute struct {
+	Package    string
+	Controller string
+	Method     string
+	Prefix     string
+	Annotation string
+	Directives []string
+	Invoke     Invoker
+}
+
+var compiled struct {
+	sync.Mutex
+	routes []CompiledRoute
+}
+
+// Register adds compiled routes to the ones served by Run. Generated files
+// call it from their init function.
+func Register(routes ...CompiledRoute) {
+	compiled.Lock()
+	defer compiled.Unlock()
+	compiled.routes = append(compiled.routes, routes...)
+}
+
+func compiledRoutes() []CompiledRoute {
+	compiled.Lock()
+	defer compiled.Unlock()
+	return append([]CompiledRoute(nil), compiled.routes...)
+}
+
+func newCompiledRoutingTable(routes []CompiledRoute, controllers []Controller) (*routingTable, error) {
+	table := newRouter()
+	set := newControllerSet(controllers)
+
+	for _, compiledRoute := range routes {
+		controller, ok := set.lookup(compiledRoute.Controller, compiledRoute.Package)
+		if !ok {
+			continue
+		}
+
+		// The generated code asserts the controller to *T for methods with
+		// a pointer receiver, which a T passed by value does not have.
+		if !controller.MethodByName(compiledRoute.Method).IsValid() {
+			return nil, fmt.Errorf("%s.%s is annotated as a route but is not an exported method of %s",
+				compiledRoute.Controller, compiledRoute.Method, controller.Type())
+		}
+
+		info, err := compiledRoute.route()
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", compiledRoute.Controller, compiledRoute.Method, err)
+		}
+
+		directives := make([]*metadata.DirectiveInfo, len(compiledRoute.Directives))
+		for i, annotation := range compiledRoute.Directives {
+			meta, err := parseAnnotation(annotation, metadata.Directive)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %v", compiledRoute.Controller, compiledRoute.Method, err)
+			}
+			directives[i] = meta.Info.(*metadata.DirectiveInfo)
+		}
+
+		body, err := newBodyOptions(directives)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", compiledRoute.Controller, compiledRoute.Method, err)
+		}
+		guard, err := newGuard(directives)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", compiledRoute.Controller, compiledRoute.Method, err)
+		}
+
+		err = table.add(&route{
+			name:       compiledRoute.Controller + "." + compiledRoute.Method,
+			info:       info,
+			directives: directives,
+			body:       body,
+			guard:      guard,
+			controller: controller.Interface(),
+			invoke:     compiledRoute.Invoke,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", compiledRoute.Controller, compiledRoute.Method, err)
+		}
+	}
+
+	return table, nil
+}
+
+func (compiledRoute *CompiledRoute) route() (*metadata.RouteInfo, error) {
+	meta, err := parseAnnotation(compiledRoute.Annotation, metadata.Route)
+	if err != nil {
+		return nil, err
+	}
+	controller := new(metadata.ControllerInfo)
+	if compiledRoute.Prefix != "" {
+		prefix, err := parseAnnotation(compiledRoute.Prefix, metadata.Prefix)
+		if err != nil {
+			return nil, err
+		}
+		controller.Prefix = prefix.Info.(*metadata.RouteInfo)
+	}
+	return controller.Route(meta.Info.(*metadata.RouteInfo))
+}
+
+func parseAnnotation(annotation string, expected metadata.MetadataType) (*metadata.Metadata, error) {
+	meta, err := metadata.ParseMetadata(annotation)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil || meta.Type != expected {
+		return nil, fmt.Errorf("%q is not a %s annotation", annotation, annotationKinds[expected])
+	}
+	return meta, nil
+}
+
+var annotationKinds = map[metadata.MetadataType]string{
+	metadata.Route:     "route",
+	metadata.Prefix:    "route prefix",
+	metadata.Directive: "directive",
+}
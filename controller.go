@@ -15,15 +15,34 @@
 package winter
 
 type Context struct {
-	interceptors    []*Interceptor
+	interceptors    []Interceptor
+	named           map[string]Interceptor
 	validators      []*Validator
 	sessions        []*Session
 	responseFormats []*ResponseFormat
-	exceptions      []*Exception
+	exceptions      []exceptionMapping
 }
 
+// Use registers interceptors that wrap every route, in the order their
+// Before runs.
+func (context *Context) Use(interceptors ...Interceptor) {
+	context.interceptors = append(context.interceptors, interceptors...)
+}
+
+// Register names an interceptor so that routes can declare it with
+// //> @use, on their method or on their controller.
+func (context *Context) Register(name string, interceptor Interceptor) {
+	if context.named == nil {
+		context.named = make(map[string]Interceptor)
+	}
+	context.named[name] = interceptor
+}
+
+// Exception is an error answered with a status of its own rather than as
+// an internal server error.
 type Exception interface {
-	error() error
+	error
+	Status() int
 }
 
 type Controller interface {
@@ -0,0 +1,278 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"encoding"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// ConversionError reports a path variable, query argument, header, cookie
+// or remote address whose value does not fit the type of the handler
+// parameter it is bound to. Source is empty for variables and arguments.
+type ConversionError struct {
+	Variable string
+	Value    string
+	Type     string
+	Err      error
+	Source   string
+}
+
+func (err *ConversionError) Error() string {
+	variable := ":" + err.Variable
+	if err.Source != "" {
+		variable = err.Source + " " + err.Variable
+	}
+	return fmt.Sprintf("invalid value %q for %s: expected %s (%v)", err.Value, variable, err.Type, err.Err)
+}
+
+func (err *ConversionError) Unwrap() error {
+	return err.Err
+}
+
+func (err *ConversionError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (arguments *Arguments) conversionError(name, value, typ string, err error) error {
+	if numError, ok := err.(*strconv.NumError); ok {
+		err = numError.Err
+	}
+	return &ConversionError{name, value, typ, err, arguments.source}
+}
+
+// Has reports whether the request carries the named variable or argument.
+// Parameters of pointer type are left nil when it does not.
+func (arguments *Arguments) Has(name string) bool {
+	if _, ok := arguments.Path.Lookup(name); ok {
+		return true
+	}
+	_, ok := arguments.Query[name]
+	return ok
+}
+
+// Values returns every value of the named variable or argument, as bound
+// to parameters of slice type when a query key is repeated.
+func (arguments *Arguments) Values(name string) []string {
+	if value, ok := arguments.Path.Lookup(name); ok {
+		return []string{value}
+	}
+	return arguments.Query[name]
+}
+
+// Len returns the number of values of the named variable or argument.
+func (arguments *Arguments) Len(name string) int {
+	if _, ok := arguments.Path.Lookup(name); ok {
+		return 1
+	}
+	return len(arguments.Query[name])
+}
+
+// At returns the i-th value of the named variable or argument as arguments
+// of their own, so that the typed accessors convert the elements of a
+// slice.
+func (arguments *Arguments) At(name string, i int) *Arguments {
+	return &Arguments{Query: url.Values{name: {arguments.Values(name)[i]}}, source: arguments.source}
+}
+
+// The typed accessors below return the zero value when the variable is
+// absent and a *ConversionError when it cannot be parsed.
+
+func (arguments *Arguments) Bool(name string) (bool, error) {
+	if !arguments.Has(name) {
+		return false, nil
+	}
+	value := arguments.Get(name)
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, arguments.conversionError(name, value, "bool", err)
+	}
+	return b, nil
+}
+
+func (arguments *Arguments) Int(name string, bitSize int) (int64, error) {
+	if !arguments.Has(name) {
+		return 0, nil
+	}
+	value := arguments.Get(name)
+	i, err := strconv.ParseInt(value, 10, bitSize)
+	if err != nil {
+		return 0, arguments.conversionError(name, value, sized("int", bitSize), err)
+	}
+	return i, nil
+}
+
+func (arguments *Arguments) Uint(name string, bitSize int) (uint64, error) {
+	if !arguments.Has(name) {
+		return 0, nil
+	}
+	value := arguments.Get(name)
+	u, err := strconv.ParseUint(value, 10, bitSize)
+	if err != nil {
+		return 0, arguments.conversionError(name, value, sized("uint", bitSize), err)
+	}
+	return u, nil
+}
+
+func (arguments *Arguments) Float(name string, bitSize int) (float64, error) {
+	if !arguments.Has(name) {
+		return 0, nil
+	}
+	value := arguments.Get(name)
+	f, err := strconv.ParseFloat(value, bitSize)
+	if err != nil {
+		return 0, arguments.conversionError(name, value, sized("float", bitSize), err)
+	}
+	return f, nil
+}
+
+func (arguments *Arguments) Duration(name string) (time.Duration, error) {
+	if !arguments.Has(name) {
+		return 0, nil
+	}
+	value := arguments.Get(name)
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, arguments.conversionError(name, value, "time.Duration", err)
+	}
+	return d, nil
+}
+
+// Text decodes the named variable into target, which is how time.Time and
+// any other encoding.TextUnmarshaler parameter is bound.
+func (arguments *Arguments) Text(name string, target encoding.TextUnmarshaler) error {
+	if !arguments.Has(name) {
+		return nil
+	}
+	value := arguments.Get(name)
+	if err := target.UnmarshalText([]byte(value)); err != nil {
+		return arguments.conversionError(name, value, strings.TrimPrefix(fmt.Sprintf("%T", target), "*"), err)
+	}
+	return nil
+}
+
+func sized(kind string, bitSize int) string {
+	if bitSize == 0 {
+		return kind
+	}
+	return kind + strconv.Itoa(bitSize)
+}
+
+type conversion func(arguments *Arguments, name string) (reflect.Value, error)
+
+// converter resolves, once per handler parameter, how a variable is turned
+// into a value of typ so that dispatching does not inspect types again.
+func converter(typ reflect.Type) (conversion, error) {
+	if typ.Kind() == reflect.Ptr {
+		elem, err := converter(typ.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return func(arguments *Arguments, name string) (reflect.Value, error) {
+			if !arguments.Has(name) {
+				return reflect.Zero(typ), nil
+			}
+			value, err := elem(arguments, name)
+			if err != nil {
+				return value, err
+			}
+			pointer := reflect.New(typ.Elem())
+			pointer.Elem().Set(value)
+			return pointer, nil
+		}, nil
+	}
+
+	if reflect.PtrTo(typ).Implements(textUnmarshalerType) {
+		return func(arguments *Arguments, name string) (reflect.Value, error) {
+			pointer := reflect.New(typ)
+			err := arguments.Text(name, pointer.Interface().(encoding.TextUnmarshaler))
+			return pointer.Elem(), err
+		}, nil
+	}
+
+	if typ.Kind() == reflect.Slice {
+		elem, err := converter(typ.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return func(arguments *Arguments, name string) (reflect.Value, error) {
+			n := arguments.Len(name)
+			slice := reflect.MakeSlice(typ, n, n)
+			for i := 0; i < n; i++ {
+				value, err := elem(arguments.At(name, i), name)
+				if err != nil {
+					return reflect.Zero(typ), err
+				}
+				slice.Index(i).Set(value)
+			}
+			return slice, nil
+		}, nil
+	}
+
+	if typ == durationType {
+		return func(arguments *Arguments, name string) (reflect.Value, error) {
+			d, err := arguments.Duration(name)
+			return reflect.ValueOf(d), err
+		}, nil
+	}
+
+	var convert func(arguments *Arguments, name string) (interface{}, error)
+	switch typ.Kind() {
+	case reflect.String:
+		convert = func(arguments *Arguments, name string) (interface{}, error) {
+			return arguments.Get(name), nil
+		}
+	case reflect.Bool:
+		convert = func(arguments *Arguments, name string) (interface{}, error) {
+			return arguments.Bool(name)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		convert = func(arguments *Arguments, name string) (interface{}, error) {
+			return arguments.Int(name, typ.Bits())
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		convert = func(arguments *Arguments, name string) (interface{}, error) {
+			return arguments.Uint(name, typ.Bits())
+		}
+	case reflect.Float32, reflect.Float64:
+		convert = func(arguments *Arguments, name string) (interface{}, error) {
+			return arguments.Float(name, typ.Bits())
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type %s", typ)
+	}
+
+	return func(arguments *Arguments, name string) (reflect.Value, error) {
+		value, err := convert(arguments, name)
+		if err != nil {
+			if err, ok := err.(*ConversionError); ok {
+				err.Type = typ.String()
+			}
+			return reflect.Zero(typ), err
+		}
+		return reflect.ValueOf(value).Convert(typ), nil
+	}, nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func arguments(path Params, query string) *Arguments {
+	values, _ := url.ParseQuery(query)
+	return &Arguments{Path: path, Query: values}
+}
+
+func convertTo(t *testing.T, typ reflect.Type, query string) (interface{}, error) {
+	convert, err := converter(typ)
+	assert.NoError(t, err)
+	value, err := convert(arguments(nil, query), "v")
+	return value.Interface(), err
+}
+
+type level uint8
+
+func TestConvertBasicTypes(t *testing.T) {
+	for _, test := range []struct {
+		query    string
+		expected interface{}
+	}{
+		{"v=-8", int8(-8)},
+		{"v=65535", uint16(65535)},
+		{"v=2.5", float32(2.5)},
+		{"v=true", true},
+		{"v=hello", "hello"},
+		{"v=3", level(3)},
+		{"v=1m", time.Minute},
+		{"", int64(0)},
+	} {
+		value, err := convertTo(t, reflect.TypeOf(test.expected), test.query)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, value)
+	}
+}
+
+func TestConvertTextUnmarshaler(t *testing.T) {
+	value, err := convertTo(t, reflect.TypeOf(time.Time{}), "v=2017-05-01T10:00:00Z")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC), value)
+}
+
+func TestConvertOptionalPointer(t *testing.T) {
+	value, err := convertTo(t, reflect.TypeOf((*int)(nil)), "")
+	assert.NoError(t, err)
+	assert.Nil(t, value)
+
+	value, err = convertTo(t, reflect.TypeOf((*int)(nil)), "v=12")
+	assert.NoError(t, err)
+	assert.Equal(t, 12, *value.(*int))
+}
+
+func TestConvertOutOfRange(t *testing.T) {
+	_, err := convertTo(t, reflect.TypeOf(int8(0)), "v=300")
+	assert.EqualError(t, err, `invalid value "300" for :v: expected int8 (value out of range)`)
+}
+
+func TestConvertUnsupportedType(t *testing.T) {
+	_, err := converter(reflect.TypeOf(complex64(0)))
+	assert.EqualError(t, err, "unsupported type complex64")
+}
+
+func TestConvertSlice(t *testing.T) {
+	value, err := convertTo(t, reflect.TypeOf([]uint16(nil)), "v=1&v=2&v=3")
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{1, 2, 3}, value)
+
+	value, err = convertTo(t, reflect.TypeOf([]string(nil)), "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, value)
+
+	_, err = convertTo(t, reflect.TypeOf([]int8(nil)), "v=1&v=300")
+	assert.EqualError(t, err, `invalid value "300" for :v: expected int8 (value out of range)`)
+}
@@ -0,0 +1,188 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// Problem is an Exception rendered as application/problem+json, following
+// RFC 7807. The constructors below build the ones of the usual statuses.
+// They share this one type, as problems only differ by their status and
+// are all rendered alike: callers tell them apart with errors.As and
+// Status, as in
+//
+//	var problem *winter.Problem
+//	if errors.As(err, &problem) && problem.Status() == http.StatusNotFound {
+//		...
+//	}
+type Problem struct {
+	Type     string       `json:"type,omitempty"`
+	Title    string       `json:"title"`
+	Code     int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Fields   []FieldError `json:"errors,omitempty"`
+	Stack    []string     `json:"stack,omitempty"`
+	Err      error        `json:"-"`
+}
+
+// FieldError is the error of a single field of the request, such as a path
+// variable, a query argument or a field of its body.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// NewProblem returns the problem of the given status, titled after it.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{Type: "about:blank", Title: http.StatusText(status), Code: status, Detail: detail}
+}
+
+func BadRequest(detail string, fields ...FieldError) *Problem {
+	problem := NewProblem(http.StatusBadRequest, detail)
+	problem.Fields = fields
+	return problem
+}
+
+func Unauthorized(detail string) *Problem {
+	return NewProblem(http.StatusUnauthorized, detail)
+}
+
+func Forbidden(detail string) *Problem {
+	return NewProblem(http.StatusForbidden, detail)
+}
+
+func NotFound(detail string) *Problem {
+	return NewProblem(http.StatusNotFound, detail)
+}
+
+func Conflict(detail string) *Problem {
+	return NewProblem(http.StatusConflict, detail)
+}
+
+func Unprocessable(detail string, fields ...FieldError) *Problem {
+	problem := NewProblem(http.StatusUnprocessableEntity, detail)
+	problem.Fields = fields
+	return problem
+}
+
+// Internal wraps an unexpected error. Its message is kept in Err, for
+// reporting, rather than shown to clients; only servers in development
+// show it as the detail.
+func Internal(err error) *Problem {
+	problem := NewProblem(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	problem.Err = err
+	return problem
+}
+
+// Error is the message of the wrapped error, if any, so that it is logged
+// and reported even when clients are not shown it.
+func (problem *Problem) Error() string {
+	if problem.Err != nil {
+		return problem.Err.Error()
+	}
+	if problem.Detail != "" {
+		return problem.Detail
+	}
+	return problem.Title
+}
+
+func (problem *Problem) Status() int {
+	return problem.Code
+}
+
+func (problem *Problem) Unwrap() error {
+	return problem.Err
+}
+
+type exceptionMapping struct {
+	target  interface{}
+	convert func(error) Exception
+}
+
+// MapError registers the Exception errors are answered with. Like the
+// target of errors.As, target is a pointer to a variable of an error type,
+// as in new(*os.PathError); an error value such as sql.ErrNoRows is matched
+// with errors.Is instead. Mappings are tried in the order they were
+// registered.
+func (context *Context) MapError(target interface{}, convert func(error) Exception) {
+	if _, sentinel := target.(error); !sentinel {
+		if typ := reflect.TypeOf(target); typ == nil || typ.Kind() != reflect.Ptr {
+			panic("winter: MapError target must be a non-nil pointer or an error")
+		}
+	}
+	context.exceptions = append(context.exceptions, exceptionMapping{target, convert})
+}
+
+// exception resolves the Exception an error is answered with: the error
+// itself or one it wraps, then the mappings of the context, and otherwise
+// an internal server error.
+func exception(mappings []exceptionMapping, err error) Exception {
+	var exception Exception
+	if errors.As(err, &exception) {
+		return exception
+	}
+	for _, mapping := range mappings {
+		if sentinel, ok := mapping.target.(error); ok {
+			if errors.Is(err, sentinel) {
+				return mapping.convert(err)
+			}
+			continue
+		}
+		target := reflect.New(reflect.TypeOf(mapping.target).Elem())
+		if errors.As(err, target.Interface()) {
+			return mapping.convert(target.Elem().Interface().(error))
+		}
+	}
+	return Internal(err)
+}
+
+// problem renders an Exception as a Problem of the request at path.
+func problem(exception Exception, path string) *Problem {
+	var rendered Problem
+	if p, ok := exception.(*Problem); ok {
+		rendered = *p
+	} else {
+		rendered = *NewProblem(exception.Status(), exception.Error())
+		var conversion *ConversionError
+		if errors.As(exception, &conversion) {
+			rendered.Fields = []FieldError{{conversion.Variable, fmt.Sprintf("expected %s", conversion.Type)}}
+		}
+	}
+	if rendered.Type == "" {
+		rendered.Type = "about:blank"
+	}
+	if rendered.Title == "" {
+		rendered.Title = http.StatusText(rendered.Code)
+	}
+	if rendered.Instance == "" {
+		rendered.Instance = path
+	}
+	return &rendered
+}
+
+func writeProblem(response http.ResponseWriter, problem *Problem) {
+	header := response.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Type", "application/problem+json")
+	header.Set("X-Content-Type-Options", "nosniff")
+	response.WriteHeader(problem.Code)
+	json.NewEncoder(response).Encode(problem)
+}
@@ -0,0 +1,90 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errLocked = errors.New("locked")
+
+func testMappings() []exceptionMapping {
+	context := new(Context)
+	context.MapError(new(*fs.PathError), func(err error) Exception {
+		return NotFound("no such file " + err.(*fs.PathError).Path)
+	})
+	context.MapError(errLocked, func(err error) Exception {
+		return Conflict(err.Error())
+	})
+	return context.exceptions
+}
+
+func TestExceptionMapping(t *testing.T) {
+	_, err := os.Open("/no/such/file")
+	assert.Equal(t, NotFound("no such file /no/such/file"), exception(testMappings(), fmt.Errorf("loading: %w", err)))
+
+	assert.Equal(t, Conflict("customer: locked"), exception(testMappings(), fmt.Errorf("customer: %w", errLocked)))
+
+	forbidden := Forbidden("not yours")
+	assert.Equal(t, forbidden, exception(testMappings(), fmt.Errorf("wrapped: %w", forbidden)))
+
+	var wrapped *Problem
+	assert.True(t, errors.As(fmt.Errorf("wrapped: %w", forbidden), &wrapped))
+	assert.Equal(t, http.StatusForbidden, wrapped.Status())
+
+	internal := exception(testMappings(), errors.New("disk full"))
+	assert.Equal(t, http.StatusInternalServerError, internal.Status())
+	assert.Equal(t, "disk full", internal.Error())
+}
+
+func TestProblemRendering(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	writeProblem(newResponse(recorder), problem(Unprocessable("invalid customer",
+		FieldError{"email", "must not be empty"}), "/customers"))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.Equal(t, "application/problem+json", recorder.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{
+		"type": "about:blank",
+		"title": "Unprocessable Entity",
+		"status": 422,
+		"detail": "invalid customer",
+		"instance": "/customers",
+		"errors": [{"field": "email", "message": "must not be empty"}]
+	}`, recorder.Body.String())
+}
+
+func TestProblemOfConversionError(t *testing.T) {
+	rendered := problem(&ConversionError{Variable: "id", Value: "x", Type: "int", Err: errors.New("invalid syntax")}, "/")
+	assert.Equal(t, http.StatusBadRequest, rendered.Code)
+	assert.Equal(t, []FieldError{{"id", "expected int"}}, rendered.Fields)
+}
+
+func TestDispatchMappedError(t *testing.T) {
+	table := newTestRoutingTable(t)
+	table.exceptions = testMappings()
+
+	recorder := serve(table, "DELETE", "/customers/42")
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Equal(t, "/customers/42", decodeProblem(t, recorder).Instance)
+}
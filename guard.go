@@ -0,0 +1,111 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/rrborja/winter/metadata"
+)
+
+// guard is read from the directives of a route: @auth requires the
+// session of the request to authenticate, and @produces lists the media
+// types the route answers with, negotiated against the Accept header.
+type guard struct {
+	auth     bool
+	produces []string
+}
+
+func newGuard(directives []*metadata.DirectiveInfo) (guard, error) {
+	var g guard
+	for _, directive := range directives {
+		switch directive.Name {
+		case "auth":
+			if len(directive.Arguments) > 0 {
+				return g, errors.New("@auth takes no arguments")
+			}
+			g.auth = true
+		case "produces":
+			if len(directive.Arguments) == 0 {
+				return g, errors.New("@produces expects media types such as application/json")
+			}
+			g.produces = nil
+			for _, argument := range directive.Arguments {
+				mediaType, _, err := mime.ParseMediaType(argument)
+				if err != nil || !strings.Contains(mediaType, "/") {
+					return g, fmt.Errorf("@produces: invalid media type %q", argument)
+				}
+				g.produces = append(g.produces, mediaType)
+			}
+		}
+	}
+	return g, nil
+}
+
+// check refuses the request when it is not authenticated or accepts none
+// of the media types of the route. Otherwise the response is given the
+// first acceptable one as its content type, which the handler can change.
+func (g guard) check(req *http.Request, response Response, session *Handler) error {
+	if g.auth {
+		if session == nil {
+			return Unauthorized("no session to authenticate the request with")
+		}
+		if !session.Authenticate() {
+			response.Header().Set("WWW-Authenticate", "Bearer")
+			return session.Authentication()
+		}
+	}
+	if len(g.produces) > 0 {
+		mediaType := negotiate(req.Header.Values("Accept"), g.produces)
+		if mediaType == "" {
+			return NewProblem(http.StatusNotAcceptable, "acceptable media types are "+strings.Join(g.produces, ", "))
+		}
+		if response.Header().Get("Content-Type") == "" {
+			response.Header().Set("Content-Type", mediaType)
+		}
+	}
+	return nil
+}
+
+// negotiate returns the first of the produced media types that the Accept
+// headers allow, any of them when there is no such header.
+func negotiate(accept []string, produces []string) string {
+	if len(accept) == 0 {
+		return produces[0]
+	}
+	var ranges []string
+	for _, header := range accept {
+		for _, element := range strings.Split(header, ",") {
+			mediaRange, params, err := mime.ParseMediaType(strings.TrimSpace(element))
+			if err != nil || params["q"] == "0" || strings.HasPrefix(params["q"], "0.0") && strings.Trim(params["q"], "0.") == "" {
+				continue
+			}
+			ranges = append(ranges, mediaRange)
+		}
+	}
+	for _, mediaType := range produces {
+		for _, mediaRange := range ranges {
+			if mediaRange == "*/*" || mediaRange == mediaType ||
+				strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")) {
+				return mediaType
+			}
+		}
+	}
+	return ""
+}
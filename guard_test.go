@@ -0,0 +1,123 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/rrborja/winter/metadata"
+	"github.com/stretchr/testify/assert"
+)
+
+type Accounts struct {
+	Controller
+}
+
+// > GET /accounts/:id
+// > @auth
+// > @produces application/json, text/csv
+func (accounts *Accounts) GetAccount(
+	id string, //> :id
+	response Response,
+) error {
+	_, err := response.Write([]byte(`{"id":"` + id + `"}`))
+	return err
+}
+
+func newGuardedRoutingTable(t *testing.T, session *Handler) *routingTable {
+	registry, err := metadata.ScanFile("guard_test.go", nil)
+	assert.NoError(t, err)
+	table, err := newRoutingTable(registry, []Controller{new(Accounts)})
+	assert.NoError(t, err)
+	table.session = session
+	return table
+}
+
+func TestGuardAuth(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	session := &Handler{Store: Store{Security{Key: map[string]crypto.Signer{"winter:ann": privateKey}}}}
+	table := newGuardedRoutingTable(t, session)
+
+	recorder := serve(table, "GET", "/accounts/7")
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Equal(t, "Bearer", recorder.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, "winter: no session token", decodeProblem(t, recorder).Detail)
+
+	token := sign(t, jwt.SigningMethodRS256, privateKey, &jwt.StandardClaims{
+		Issuer: "winter", Subject: "ann", ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	})
+	req := httptest.NewRequest("GET", "/accounts/7", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	recorder = httptest.NewRecorder()
+	table.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, `{"id":"7"}`, recorder.Body.String())
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+	recorder = serve(newGuardedRoutingTable(t, nil), "GET", "/accounts/7")
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestGuardProduces(t *testing.T) {
+	table := newGuardedRoutingTable(t, nil)
+	table.routes[0].guard.auth = false
+
+	for accept, expected := range map[string]string{
+		"":                               "application/json",
+		"text/csv":                       "text/csv",
+		"text/*, application/json;q=0":   "text/csv",
+		"application/xml, */*;q=0.1":     "application/json",
+		"application/xml":                "",
+		"text/csv;q=0, application/json": "application/json",
+	} {
+		req := httptest.NewRequest("GET", "/accounts/7", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		recorder := httptest.NewRecorder()
+		table.ServeHTTP(recorder, req)
+		if expected == "" {
+			assert.Equal(t, http.StatusNotAcceptable, recorder.Code, accept)
+			continue
+		}
+		assert.Equal(t, http.StatusOK, recorder.Code, accept)
+		assert.Equal(t, expected, recorder.Header().Get("Content-Type"), accept)
+	}
+}
+
+func TestGuardDirectives(t *testing.T) {
+	_, err := newGuard(directives(t, "//> @auth admin"))
+	assert.EqualError(t, err, "@auth takes no arguments")
+
+	_, err = newGuard(directives(t, "//> @produces json"))
+	assert.EqualError(t, err, `@produces: invalid media type "json"`)
+
+	source, err := os.ReadFile("guard_test.go")
+	assert.NoError(t, err)
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "accounts.go"), source, 0644))
+	_, err = loadRoutingTable(Options{Source: dir, Controllers: []Controller{new(Accounts)}})
+	assert.EqualError(t, err, "Accounts.GetAccount: @auth needs a Session")
+}
@@ -1,10 +1,99 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
 package winter
 
+import (
+	"fmt"
+	"net/http"
+)
+
+// Interceptor wraps the routes it is registered for. Before runs ahead of
+// the handler and stops the request when it returns false, After runs once
+// the handler succeeded and can fail the request with an Exception, and
+// Done always runs last, once the response has been written, with the
+// error the request ended with, if any.
 type Interceptor interface {
-	before(Request, Response) bool
-	after(Response, Request) Exception
-	done(Response, Request, error)
+	Before(Request, Response) bool
+	After(Response, Request) Exception
+	Done(Response, Request, error)
 }
 
 type Validator interface {
 }
+
+// PanicError is the error Done receives when a handler or an interceptor
+// panicked. Only a panic with http.ErrAbortHandler goes on once every Done
+// has run.
+type PanicError struct {
+	Value interface{}
+}
+
+func (err *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", err.Value)
+}
+
+type chain []Interceptor
+
+// serve runs the Before of each interceptor in order and, unless one of
+// them stopped the request, the handler and then the After of each in
+// reverse order. The first Exception of an After becomes the error of the
+// request, and a panic a *PanicError. The request is then answered with
+// its error, and the Done of every interceptor whose Before ran is called
+// in reverse order.
+func (chain chain) serve(request Request, response Response, handle func() error, answer func(error)) (err error) {
+	entered := 0
+	defer func() {
+		value := recover()
+		if value != nil {
+			err = &PanicError{value}
+		}
+		if answer != nil {
+			answer(err)
+		}
+		for i := entered - 1; i >= 0; i-- {
+			chain.done(i, request, response, err)
+		}
+		if value == http.ErrAbortHandler {
+			panic(value)
+		}
+	}()
+
+	for _, interceptor := range chain {
+		entered++
+		if !interceptor.Before(request, response) {
+			return nil
+		}
+	}
+
+	if err = handle(); err != nil {
+		return err
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		if exception := chain[i].After(response, request); exception != nil {
+			return exception
+		}
+	}
+	return nil
+}
+
+// done calls Done of the i-th interceptor, carrying on with the others when
+// it panics itself.
+func (chain chain) done(i int, request Request, response Response, err error) {
+	defer func() {
+		recover()
+	}()
+	chain[i].Done(response, request, err)
+}
@@ -0,0 +1,191 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingInterceptor struct {
+	name      string
+	log       *[]string
+	stop      bool
+	exception Exception
+}
+
+func (i *recordingInterceptor) Before(request Request, response Response) bool {
+	*i.log = append(*i.log, "before "+i.name)
+	return !i.stop
+}
+
+func (i *recordingInterceptor) After(response Response, request Request) Exception {
+	*i.log = append(*i.log, "after "+i.name)
+	return i.exception
+}
+
+func (i *recordingInterceptor) Done(response Response, request Request, err error) {
+	if err != nil {
+		*i.log = append(*i.log, "done "+i.name+": "+err.Error())
+	} else {
+		*i.log = append(*i.log, "done "+i.name)
+	}
+}
+
+type conflict struct{}
+
+func (conflict) Error() string { return "conflict" }
+func (conflict) Status() int   { return http.StatusConflict }
+
+func interceptors(log *[]string, names ...string) chain {
+	list := make(chain, len(names))
+	for i, name := range names {
+		list[i] = &recordingInterceptor{name: name, log: log}
+	}
+	return list
+}
+
+func serveChain(list chain, handle func() error) error {
+	response := newResponse(httptest.NewRecorder())
+	return list.serve(nil, response, handle, nil)
+}
+
+func TestInterceptorOrder(t *testing.T) {
+	var log []string
+	err := serveChain(interceptors(&log, "a", "b"), func() error {
+		log = append(log, "handler")
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"before a", "before b", "handler", "after b", "after a", "done b", "done a"}, log)
+}
+
+func TestInterceptorShortCircuit(t *testing.T) {
+	var log []string
+	list := interceptors(&log, "a", "b", "c")
+	list[1].(*recordingInterceptor).stop = true
+
+	err := serveChain(list, func() error {
+		log = append(log, "handler")
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"before a", "before b", "done b", "done a"}, log)
+}
+
+func TestInterceptorAfterException(t *testing.T) {
+	var log []string
+	list := interceptors(&log, "a", "b")
+	list[1].(*recordingInterceptor).exception = conflict{}
+
+	err := serveChain(list, func() error { return nil })
+	assert.Equal(t, conflict{}, err)
+	assert.Equal(t, []string{"before a", "before b", "after b", "done b: conflict", "done a: conflict"}, log)
+}
+
+func TestInterceptorHandlerError(t *testing.T) {
+	var log []string
+	err := serveChain(interceptors(&log, "a"), func() error { return errors.New("locked") })
+	assert.EqualError(t, err, "locked")
+	assert.Equal(t, []string{"before a", "done a: locked"}, log)
+}
+
+func TestInterceptorDoneOnPanic(t *testing.T) {
+	var log []string
+	err := interceptors(&log, "a", "b").serve(nil, newResponse(httptest.NewRecorder()), func() error {
+		panic("boom")
+	}, func(err error) {
+		log = append(log, "answer "+err.Error())
+	})
+	assert.Equal(t, &PanicError{"boom"}, err)
+	assert.Equal(t, []string{"before a", "before b", "answer panic: boom", "done b: panic: boom", "done a: panic: boom"}, log)
+
+	log = nil
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		serveChain(interceptors(&log, "a"), func() error { panic(http.ErrAbortHandler) })
+	})
+	assert.Equal(t, []string{"before a", "done a: panic: net/http: abort Handler"}, log)
+}
+
+func TestDispatchInterceptors(t *testing.T) {
+	var log []string
+	list := interceptors(&log, "global", "audit")
+	list[1].(*recordingInterceptor).exception = conflict{}
+
+	context := new(Context)
+	context.Use(list[0])
+	context.Register("Audit", list[1])
+
+	table := newTestRoutingTable(t)
+	assert.NoError(t, table.intercept(context))
+
+	recorder := serve(table, "POST", "/customers/42/notes")
+	assert.Equal(t, []string{"before global", "before audit", "after audit", "done audit: conflict", "done global: conflict"}, log)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Equal(t, "conflict", decodeProblem(t, recorder).Detail)
+	assert.Empty(t, recorder.Header().Get("Location"))
+
+	log = nil
+	serve(table, "GET", "/customers/42")
+	assert.Equal(t, []string{"before global", "after global", "done global"}, log)
+}
+
+type probeInterceptor struct {
+	status  *int
+	written *int64
+}
+
+func (probeInterceptor) Before(Request, Response) bool     { return true }
+func (probeInterceptor) After(Response, Request) Exception { return nil }
+
+func (probe probeInterceptor) Done(response Response, request Request, err error) {
+	*probe.status = response.Status()
+	*probe.written = response.Written()
+}
+
+func TestDispatchDoneObservesResponse(t *testing.T) {
+	var status int
+	var written int64
+	context := new(Context)
+	context.Use(probeInterceptor{&status, &written})
+	context.Register("Audit", probeInterceptor{new(int), new(int64)})
+	table := newTestRoutingTable(t)
+	assert.NoError(t, table.intercept(context))
+
+	for target, expected := range map[string]int{
+		"GET /customers/seven/invoices": http.StatusBadRequest,
+		"GET /customers/7/crash":        http.StatusInternalServerError,
+		"DELETE /customers/7":           http.StatusInternalServerError,
+		"POST /customers/7/notes":       http.StatusCreated,
+		"GET /customers/7":              http.StatusOK,
+	} {
+		request := strings.Fields(target)
+		recorder := serve(table, request[0], request[1])
+		assert.Equal(t, expected, recorder.Code, target)
+		assert.Equal(t, expected, status, target)
+		assert.Equal(t, int64(recorder.Body.Len()), written, target)
+		assert.NotZero(t, written, target)
+	}
+}
+
+func TestUnregisteredInterceptor(t *testing.T) {
+	err := newTestRoutingTable(t).intercept(new(Context))
+	assert.EqualError(t, err, "Customers.PostNote: no interceptor is registered as Audit")
+}
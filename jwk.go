@@ -0,0 +1,216 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var curves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+// JWK is a JSON Web Key as defined by RFC 7517. The private members are
+// only set for keys a session can be signed with.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	X string `json:"x,omitempty"`
+	Y string `json:"y,omitempty"`
+
+	D  string `json:"d,omitempty"`
+	P  string `json:"p,omitempty"`
+	Q  string `json:"q,omitempty"`
+	DP string `json:"dp,omitempty"`
+	DQ string `json:"dq,omitempty"`
+	QI string `json:"qi,omitempty"`
+	K  string `json:"k,omitempty"`
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(member, value string) ([]byte, error) {
+	if value == "" {
+		return nil, fmt.Errorf("missing %q", member)
+	}
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %q: %v", member, err)
+	}
+	return b, nil
+}
+
+func decodeInt(member, value string) (*big.Int, error) {
+	b, err := decode(member, value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// PublicJWK describes the public half of a key of the Store, which for
+// secrets is the secret itself.
+func PublicJWK(key interface{}) (*JWK, error) {
+	if signer, ok := key.(crypto.Signer); ok {
+		key = signer.Public()
+	}
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return &JWK{Kty: "RSA", N: encode(key.N.Bytes()), E: encode(big.NewInt(int64(key.E)).Bytes())}, nil
+	case *ecdsa.PublicKey:
+		// Coordinates are as wide as the order of the curve, leading zeros
+		// included.
+		size := (key.Curve.Params().BitSize + 7) / 8
+		return &JWK{
+			Kty: "EC",
+			Crv: key.Curve.Params().Name,
+			X:   encode(key.X.FillBytes(make([]byte, size))),
+			Y:   encode(key.Y.FillBytes(make([]byte, size))),
+		}, nil
+	case ed25519.PublicKey:
+		return &JWK{Kty: "OKP", Crv: "Ed25519", X: encode(key)}, nil
+	case []byte:
+		return &JWK{Kty: "oct", K: encode(key)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", key)
+}
+
+// Thumbprint returns the RFC 7638 thumbprint of a key, which identifies a
+// signer as the kid of the tokens it signs unless its JWK names another.
+// The thumbprint of a secret is a hash of it, and is never used as a kid.
+func Thumbprint(key interface{}) (string, error) {
+	jwk, err := PublicJWK(key)
+	if err != nil {
+		return "", err
+	}
+	// The required members, in lexicographic order and without whitespace.
+	var members []string
+	switch jwk.Kty {
+	case "RSA":
+		members = []string{"e", jwk.E, "kty", jwk.Kty, "n", jwk.N}
+	case "EC":
+		members = []string{"crv", jwk.Crv, "kty", jwk.Kty, "x", jwk.X, "y", jwk.Y}
+	case "OKP":
+		members = []string{"crv", jwk.Crv, "kty", jwk.Kty, "x", jwk.X}
+	case "oct":
+		members = []string{"k", jwk.K, "kty", jwk.Kty}
+	}
+	var canonical bytes.Buffer
+	canonical.WriteByte('{')
+	for i := 0; i < len(members); i += 2 {
+		if i > 0 {
+			canonical.WriteByte(',')
+		}
+		name, _ := json.Marshal(members[i])
+		value, _ := json.Marshal(members[i+1])
+		canonical.Write(name)
+		canonical.WriteByte(':')
+		canonical.Write(value)
+	}
+	canonical.WriteByte('}')
+	sum := sha256.Sum256(canonical.Bytes())
+	return encode(sum[:]), nil
+}
+
+// Key returns the key the JWK describes: a crypto.Signer for private RSA,
+// EC and OKP keys, and the secret of oct keys.
+func (jwk *JWK) Key() (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		return jwk.rsaKey()
+	case "EC":
+		return jwk.ecdsaKey()
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		seed, err := decode("d", jwk.D)
+		if err != nil {
+			return nil, err
+		}
+		if len(seed) != ed25519.SeedSize {
+			return nil, errors.New(`invalid "d": not an Ed25519 seed`)
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	case "oct":
+		return decode("k", jwk.K)
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+func (jwk *JWK) rsaKey() (crypto.Signer, error) {
+	var values [5]*big.Int
+	for i, member := range [][2]string{{"n", jwk.N}, {"e", jwk.E}, {"d", jwk.D}, {"p", jwk.P}, {"q", jwk.Q}} {
+		value, err := decodeInt(member[0], member[1])
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	if !values[1].IsInt64() {
+		return nil, errors.New(`invalid "e"`)
+	}
+	key := &rsa.PrivateKey{
+		PublicKey: rsa.PublicKey{N: values[0], E: int(values[1].Int64())},
+		D:         values[2],
+		Primes:    []*big.Int{values[3], values[4]},
+	}
+	if err := key.Validate(); err != nil {
+		return nil, err
+	}
+	key.Precompute()
+	return key, nil
+}
+
+func (jwk *JWK) ecdsaKey() (crypto.Signer, error) {
+	curve, ok := curves[jwk.Crv]
+	if !ok {
+		return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+	}
+	d, err := decodeInt("d", jwk.D)
+	if err != nil {
+		return nil, err
+	}
+	if d.Sign() <= 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New(`invalid "d": not a scalar of the curve`)
+	}
+	key := &ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: curve}, D: d}
+	key.X, key.Y = curve.ScalarBaseMult(d.Bytes())
+	if public, err := PublicJWK(key); err != nil || public.X != jwk.X || public.Y != jwk.Y {
+		return nil, errors.New(`"x" and "y" do not match "d"`)
+	}
+	return key, nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rrborja/winter/metadata"
+)
+
+const (
+	// WellKnownJWKS is where the JWK Set of a server is usually published.
+	WellKnownJWKS = "/.well-known/jwks.json"
+
+	// DefaultJWKSMaxAge is how long the JWK Set can be cached for. A key is
+	// rotated in for at most as long before clients see it.
+	DefaultJWKSMaxAge = 5 * time.Minute
+)
+
+// JWKSet is a JSON Web Key Set as defined by RFC 7517.
+type JWKSet struct {
+	Keys []*JWK `json:"keys"`
+}
+
+// PublicJWKSet returns the public halves of the keys a KeyStore verifies
+// with, retired keys included. Secrets are never published.
+func PublicJWKSet(keys KeyStore) (*JWKSet, error) {
+	set := &JWKSet{Keys: []*JWK{}}
+	for id, key := range keys.VerificationKeys() {
+		if _, ok := key.([]byte); ok {
+			continue
+		}
+		jwk, err := PublicJWK(key)
+		if err != nil {
+			return nil, err
+		}
+		jwk.Kid = id
+		jwk.Use = "sig"
+		// RSA keys sign with any of the RS and PS algorithms.
+		if _, accepted := algorithms(key); len(accepted) == 1 {
+			for algorithm := range accepted {
+				jwk.Alg = algorithm
+			}
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+	return set, nil
+}
+
+type jwksHandler struct {
+	keys   KeyStore
+	maxAge time.Duration
+}
+
+// NewJWKSHandler serves the public JWK Set of keys, cacheable for maxAge
+// and tagged so that clients can revalidate it. It is read again for every
+// request, so that rotations are published as soon as the keys reload.
+func NewJWKSHandler(keys KeyStore, maxAge time.Duration) http.Handler {
+	return &jwksHandler{keys, maxAge}
+}
+
+func (handler *jwksHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	set, err := PublicJWKSet(handler.keys)
+	var body []byte
+	if err == nil {
+		body, err = json.Marshal(set)
+	}
+	if err != nil {
+		writeProblem(w, problem(Internal(err), req.URL.Path))
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := fmt.Sprintf(`"%s"`, encode(sum[:16]))
+
+	header := w.Header()
+	header.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(handler.maxAge/time.Second)))
+	header.Set("ETag", etag)
+	if match := req.Header.Get("If-None-Match"); match != "" && strings.Contains(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	header.Set("Content-Type", "application/jwk-set+json")
+	w.Write(body)
+}
+
+// publish serves the JWK Set of keys at path as a route of its own. It is
+// added after the interceptors are, so that services verifying tokens can
+// always fetch it.
+func (table *routingTable) publish(path string, keys KeyStore) error {
+	info := metadata.NewRouteInfo(metadata.Get{})
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		info.ConcatenatePath(segment)
+	}
+	handler := NewJWKSHandler(keys, DefaultJWKSMaxAge)
+	return table.add(&route{
+		name: "JWKS",
+		info: &info,
+		invoke: func(_ Controller, response Response, arguments *Arguments) ([]interface{}, error) {
+			handler.ServeHTTP(response, arguments.request)
+			return nil, nil
+		},
+	})
+}
@@ -0,0 +1,115 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func fetchJWKS(t *testing.T, table *routingTable, etag string) (*httptest.ResponseRecorder, *JWKSet) {
+	req := httptest.NewRequest("GET", WellKnownJWKS, nil)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	recorder := httptest.NewRecorder()
+	table.ServeHTTP(recorder, req)
+	set := new(JWKSet)
+	if recorder.Code == http.StatusOK {
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), set))
+	}
+	return recorder, set
+}
+
+func TestJWKSPublishesPublicKeys(t *testing.T) {
+	handler, privateKey := testHandler(t)
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	handler.Key["winter:bob"] = p256
+	handler.Key["winter:eve"] = ed
+	handler.Secret = map[string][]byte{"winter:kim": []byte("secret")}
+
+	table := newRouter()
+	assert.NoError(t, table.publish(WellKnownJWKS, handler.keys()))
+
+	recorder, set := fetchJWKS(t, table, "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/jwk-set+json", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "public, max-age=300", recorder.Header().Get("Cache-Control"))
+	assert.Len(t, set.Keys, 3)
+
+	published := make(map[string]*JWK)
+	for _, jwk := range set.Keys {
+		assert.Empty(t, jwk.D)
+		assert.Equal(t, "sig", jwk.Use)
+		published[jwk.Kid] = jwk
+	}
+	for i, signer := range []crypto.Signer{privateKey, p256, ed} {
+		public, _ := PublicJWK(signer)
+		id, _ := Thumbprint(signer)
+		assert.Equal(t, public.N, published[id].N)
+		assert.Equal(t, public.X, published[id].X)
+		assert.Equal(t, []string{"", "ES256", "EdDSA"}[i], published[id].Alg)
+	}
+
+	assert.NoError(t, handler.New(manifest{"winter", "bob", 0}))
+	token, _ := new(jwt.Parser).Parse(handler.Token(), nil)
+	assert.Contains(t, published, token.Header["kid"])
+
+	recorder, _ = fetchJWKS(t, table, recorder.Header().Get("ETag"))
+	assert.Equal(t, http.StatusNotModified, recorder.Code)
+	assert.Empty(t, recorder.Body.String())
+}
+
+func TestJWKSReflectsRotations(t *testing.T) {
+	dir := t.TempDir()
+	block, _ := rsaBlock(t)
+	writeKey(t, dir, "winter:ann.pem", block)
+	store, err := NewDirectoryStore(dir, time.Minute)
+	assert.NoError(t, err)
+
+	table := newRouter()
+	assert.NoError(t, table.publish(WellKnownJWKS, store))
+	recorder, set := fetchJWKS(t, table, "")
+	assert.Len(t, set.Keys, 1)
+	etag := recorder.Header().Get("ETag")
+
+	block, _ = rsaBlock(t)
+	writeKey(t, dir, "winter:ann.pem", block)
+	assert.NoError(t, store.Reload())
+
+	recorder, set = fetchJWKS(t, table, etag)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Len(t, set.Keys, 2)
+	assert.NotEqual(t, etag, recorder.Header().Get("ETag"))
+}
+
+func TestJWKSNeedsSession(t *testing.T) {
+	_, err := loadRoutingTable(Options{JWKS: WellKnownJWKS})
+	assert.EqualError(t, err, "winter: publishing a JWK Set needs a Session")
+}
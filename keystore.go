@@ -0,0 +1,362 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// KeyStore holds the keys sessions are signed and verified with, by the
+// issuer:subject name of the sessions. Every key has an id that the tokens
+// it signs carry as their kid.
+type KeyStore interface {
+	// SigningKey returns the key new tokens of the name are signed with, nil
+	// when there is none.
+	SigningKey(name string) (id string, key interface{})
+
+	// VerificationKey returns the key of the id that is or was registered
+	// for the name, or the current key of the name when id is empty.
+	VerificationKey(name, id string) interface{}
+
+	// VerificationKeys returns every key tokens are verified with, by id.
+	VerificationKeys() map[string]interface{}
+}
+
+// SigningKey returns the signer registered for the name, or else its
+// secret. The id of a signer is its thumbprint, and the one of a secret
+// the name itself, as the thumbprint of a secret is a hash of it.
+func (security Security) SigningKey(name string) (string, interface{}) {
+	if signer, ok := security.Key[name]; ok {
+		id, _ := Thumbprint(signer)
+		return id, signer
+	}
+	if secret, ok := security.Secret[name]; ok {
+		return name, secret
+	}
+	return "", nil
+}
+
+func (security Security) VerificationKey(name, id string) interface{} {
+	current, key := security.SigningKey(name)
+	if id != "" && id != current {
+		return nil
+	}
+	return key
+}
+
+func (security Security) VerificationKeys() map[string]interface{} {
+	keys := make(map[string]interface{}, len(security.Key)+len(security.Secret))
+	for _, signer := range security.Key {
+		if id, err := Thumbprint(signer); err == nil {
+			keys[id] = signer
+		}
+	}
+	for name, secret := range security.Secret {
+		keys[name] = secret
+	}
+	return keys
+}
+
+// DirectoryStore is a KeyStore of the PEM and JWK files of a directory,
+// each holding the key of the name of the file: winter:ann.pem signs the
+// sessions of subject ann issued by winter. A PEM file holds a PKCS #1,
+// PKCS #8 or SEC 1 private key and a JWK file, ending in .json or .jwk, a
+// single private key or secret.
+//
+// The id of a key is the kid of its JWK, or else its thumbprint. A secret
+// must name its kid, so that tokens do not carry a hash of it. A key that
+// is replaced or removed is still accepted for the grace period of the
+// store, so that the tokens it signed remain valid while they expire.
+type DirectoryStore struct {
+	dir   string
+	grace time.Duration
+
+	mutex   sync.RWMutex
+	keys    map[string]*storedKey
+	retired []*storedKey
+	listing string
+}
+
+type storedKey struct {
+	name  string
+	id    string
+	key   interface{}
+	until time.Time
+}
+
+// NewDirectoryStore loads the keys of dir.
+func NewDirectoryStore(dir string, grace time.Duration) (*DirectoryStore, error) {
+	store := &DirectoryStore{dir: dir, grace: grace}
+	if err := store.Reload(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (store *DirectoryStore) SigningKey(name string) (string, interface{}) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	if stored, ok := store.keys[name]; ok {
+		return stored.id, stored.key
+	}
+	return "", nil
+}
+
+func (store *DirectoryStore) VerificationKey(name, id string) interface{} {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	if stored, ok := store.keys[name]; ok && (id == "" || id == stored.id) {
+		return stored.key
+	}
+	if id == "" {
+		return nil
+	}
+	now := time.Now()
+	for _, stored := range store.retired {
+		if stored.name == name && stored.id == id && now.Before(stored.until) {
+			return stored.key
+		}
+	}
+	return nil
+}
+
+// VerificationKeys includes the retired keys still in their grace period.
+func (store *DirectoryStore) VerificationKeys() map[string]interface{} {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	keys := make(map[string]interface{}, len(store.keys)+len(store.retired))
+	now := time.Now()
+	for _, stored := range store.retired {
+		if now.Before(stored.until) {
+			keys[stored.id] = stored.key
+		}
+	}
+	for _, stored := range store.keys {
+		keys[stored.id] = stored.key
+	}
+	return keys
+}
+
+// Reload reads the keys of the directory again, retiring the ones that
+// were replaced or removed. The keys are left as they were when a file
+// cannot be read.
+func (store *DirectoryStore) Reload() error {
+	listing, err := store.list()
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(store.dir)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*storedKey)
+	for _, entry := range entries {
+		extension := filepath.Ext(entry.Name())
+		if entry.IsDir() || !keyExtension(extension) {
+			continue
+		}
+		path := filepath.Join(store.dir, entry.Name())
+		stored, err := loadKey(path, extension)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		stored.name = strings.TrimSuffix(entry.Name(), extension)
+		if _, ok := keys[stored.name]; ok {
+			return fmt.Errorf("%s: more than one key is named %s", path, stored.name)
+		}
+		keys[stored.name] = stored
+	}
+
+	now := time.Now()
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	var retired []*storedKey
+	for _, stored := range store.retired {
+		if now.Before(stored.until) {
+			retired = append(retired, stored)
+		}
+	}
+	for name, old := range store.keys {
+		if current, ok := keys[name]; !ok || current.id != old.id {
+			retiring := *old
+			retiring.until = now.Add(store.grace)
+			retired = append(retired, &retiring)
+		}
+	}
+	store.keys = keys
+	store.retired = retired
+	store.listing = listing
+	return nil
+}
+
+// Watch reloads the keys when SIGHUP is received and when the files of the
+// directory change, checking for changes at every interval. Reload errors
+// are passed to failed, which can be nil, and a change that failed to load
+// is retried at the next interval. An interval of zero or less only reloads
+// on SIGHUP. Watching ends once stop returns.
+func (store *DirectoryStore) Watch(interval time.Duration, failed func(error)) (stop func()) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	var ticker *time.Ticker
+	var ticks <-chan time.Time
+	if interval > 0 {
+		ticker = time.NewTicker(interval)
+		ticks = ticker.C
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	reload := func() {
+		if err := store.Reload(); err != nil && failed != nil {
+			failed(err)
+		}
+	}
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			case <-hangup:
+				reload()
+			case <-ticks:
+				if store.changed() {
+					reload()
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(hangup)
+			if ticker != nil {
+				ticker.Stop()
+			}
+			close(done)
+			<-stopped
+		})
+	}
+}
+
+// list describes the key files of the directory by name, size and time of
+// modification.
+func (store *DirectoryStore) list() (string, error) {
+	entries, err := os.ReadDir(store.dir)
+	if err != nil {
+		return "", err
+	}
+	var listing strings.Builder
+	for _, entry := range entries {
+		if entry.IsDir() || !keyExtension(filepath.Ext(entry.Name())) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&listing, "%s %d %d\n", entry.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+	return listing.String(), nil
+}
+
+func (store *DirectoryStore) changed() bool {
+	listing, err := store.list()
+	if err != nil {
+		return true
+	}
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	return listing != store.listing
+}
+
+func keyExtension(extension string) bool {
+	return extension == ".pem" || extension == ".json" || extension == ".jwk"
+}
+
+func loadKey(path, extension string) (*storedKey, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := new(storedKey)
+	if extension == ".pem" {
+		stored.key, err = parsePEM(content)
+	} else {
+		jwk := new(JWK)
+		if err := json.Unmarshal(content, jwk); err != nil {
+			return nil, err
+		}
+		stored.id = jwk.Kid
+		stored.key, err = jwk.Key()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, accepted := algorithms(stored.key); accepted == nil {
+		return nil, fmt.Errorf("unsupported key type %T", stored.key)
+	}
+	if _, secret := stored.key.([]byte); secret && stored.id == "" {
+		return nil, errors.New("a secret needs the kid of its JWK")
+	}
+	if stored.id == "" {
+		if stored.id, err = Thumbprint(stored.key); err != nil {
+			return nil, err
+		}
+	}
+	return stored, nil
+}
+
+func parsePEM(content []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.New("no PEM block")
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	return signer, nil
+}
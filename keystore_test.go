@@ -0,0 +1,236 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeKey(t *testing.T, dir, name string, block *pem.Block) {
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(block), 0600))
+}
+
+func writeJWK(t *testing.T, dir, name string, jwk *JWK) {
+	content, err := json.Marshal(jwk)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, name), content, 0600))
+}
+
+func rsaBlock(t *testing.T) (*pem.Block, *rsa.PrivateKey) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	return &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}, privateKey
+}
+
+func TestDirectoryStoreLoadsKeys(t *testing.T) {
+	dir := t.TempDir()
+	block, privateKey := rsaBlock(t)
+	writeKey(t, dir, "winter:ann.pem", block)
+
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(p256)
+	assert.NoError(t, err)
+	writeKey(t, dir, "winter:bob.pem", &pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	writeJWK(t, dir, "winter:eve.json", &JWK{Kty: "OKP", Crv: "Ed25519", Kid: "eve-1", X: encode(ed.Public().(ed25519.PublicKey)), D: encode(ed.Seed())})
+	writeJWK(t, dir, "winter:kim.jwk", &JWK{Kty: "oct", Kid: "kim-1", K: encode([]byte("secret"))})
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("keys"), 0600))
+
+	store, err := NewDirectoryStore(dir, time.Minute)
+	assert.NoError(t, err)
+
+	id, key := store.SigningKey("winter:ann")
+	thumbprint, _ := Thumbprint(privateKey)
+	assert.Equal(t, thumbprint, id)
+	assert.Equal(t, privateKey.D, key.(*rsa.PrivateKey).D)
+
+	id, key = store.SigningKey("winter:eve")
+	assert.Equal(t, "eve-1", id)
+	assert.Equal(t, ed, key)
+
+	handler := &Handler{Keys: store}
+	for subject, algorithm := range map[string]string{"ann": "RS256", "bob": "ES256", "eve": "EdDSA", "kim": "HS256"} {
+		assert.NoError(t, handler.New(manifest{"winter", subject, 0}))
+		token, _ := new(jwt.Parser).Parse(handler.Token(), nil)
+		assert.Equal(t, algorithm, token.Method.Alg())
+		id, _ := store.SigningKey("winter:" + subject)
+		assert.Equal(t, id, token.Header["kid"])
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+handler.Token())
+		assert.NoError(t, authenticate(handler, req).Err, subject)
+	}
+
+	id, _ = store.SigningKey("winter:kim")
+	assert.Equal(t, "kim-1", id)
+
+	writeJWK(t, dir, "winter:lou.jwk", &JWK{Kty: "oct", K: encode([]byte("secret"))})
+	assert.Error(t, store.Reload())
+	assert.NoError(t, os.Remove(filepath.Join(dir, "winter:lou.jwk")))
+
+	writeKey(t, dir, "winter:zed.pem", &pem.Block{Type: "PUBLIC KEY", Bytes: []byte{0}})
+	assert.Error(t, store.Reload())
+	_, key = store.SigningKey("winter:ann")
+	assert.NotNil(t, key)
+}
+
+func TestDirectoryStoreRotatesKeys(t *testing.T) {
+	dir := t.TempDir()
+	block, _ := rsaBlock(t)
+	writeKey(t, dir, "winter:ann.pem", block)
+
+	store, err := NewDirectoryStore(dir, 50*time.Millisecond)
+	assert.NoError(t, err)
+	handler := &Handler{Keys: store}
+	assert.NoError(t, handler.New(manifest{"winter", "ann", 0}))
+	old := handler.Token()
+
+	block, _ = rsaBlock(t)
+	writeKey(t, dir, "winter:ann.pem", block)
+	assert.NoError(t, store.Reload())
+	assert.NoError(t, handler.New(manifest{"winter", "ann", 0}))
+
+	for _, token := range []string{old, handler.Token()} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		assert.NoError(t, authenticate(handler, req).Err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+old)
+	assert.Equal(t, ErrUnknownKey, authenticate(handler, req).Err)
+}
+
+func TestSecurityIdentifiesSecretsByName(t *testing.T) {
+	security := Security{Secret: map[string][]byte{"winter:kim": []byte("secret")}}
+	id, key := security.SigningKey("winter:kim")
+	assert.Equal(t, "winter:kim", id)
+	assert.Equal(t, []byte("secret"), key)
+	assert.Equal(t, map[string]interface{}{"winter:kim": []byte("secret")}, security.VerificationKeys())
+}
+
+func TestDirectoryStoreWatchesSignalsOnly(t *testing.T) {
+	dir := t.TempDir()
+	block, _ := rsaBlock(t)
+	writeKey(t, dir, "winter:ann.pem", block)
+
+	store, err := NewDirectoryStore(dir, time.Minute)
+	assert.NoError(t, err)
+	stop := store.Watch(0, nil)
+	defer stop()
+
+	block, _ = rsaBlock(t)
+	writeKey(t, dir, "winter:bob.pem", block)
+	assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	assert.Eventually(t, func() bool {
+		_, key := store.SigningKey("winter:bob")
+		return key != nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestDirectoryStoreWatches(t *testing.T) {
+	dir := t.TempDir()
+	block, _ := rsaBlock(t)
+	writeKey(t, dir, "winter:ann.pem", block)
+
+	store, err := NewDirectoryStore(dir, time.Minute)
+	assert.NoError(t, err)
+	// A file can be read while it is being written, and is read again.
+	stop := store.Watch(10*time.Millisecond, nil)
+	defer stop()
+
+	first, _ := store.SigningKey("winter:ann")
+	block, _ = rsaBlock(t)
+	writeKey(t, dir, "winter:bob.pem", block)
+	assert.Eventually(t, func() bool {
+		_, key := store.SigningKey("winter:bob")
+		return key != nil
+	}, time.Second, 10*time.Millisecond)
+
+	// A change the listing cannot tell apart is picked up on SIGHUP.
+	info, err := os.Stat(filepath.Join(dir, "winter:ann.pem"))
+	assert.NoError(t, err)
+	block, _ = rsaBlock(t)
+	writeKey(t, dir, "winter:ann.pem", block)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "winter:ann.pem"), info.ModTime(), info.ModTime()))
+	assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	assert.Eventually(t, func() bool {
+		id, _ := store.SigningKey("winter:ann")
+		return id != first
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestJWKRoundTrip(t *testing.T) {
+	_, privateKey := rsaBlock(t)
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(t, err)
+
+	public, err := PublicJWK(privateKey)
+	assert.NoError(t, err)
+	jwk := *public
+	jwk.D, jwk.P, jwk.Q = encode(privateKey.D.Bytes()), encode(privateKey.Primes[0].Bytes()), encode(privateKey.Primes[1].Bytes())
+	key, err := jwk.Key()
+	assert.NoError(t, err)
+	assert.True(t, privateKey.Equal(key))
+
+	public, err = PublicJWK(p384)
+	assert.NoError(t, err)
+	assert.Equal(t, "P-384", public.Crv)
+	jwk = *public
+	jwk.D = encode(p384.D.Bytes())
+	key, err = jwk.Key()
+	assert.NoError(t, err)
+	assert.True(t, p384.Equal(key))
+
+	jwk.X = public.Y
+	_, err = jwk.Key()
+	assert.EqualError(t, err, `"x" and "y" do not match "d"`)
+
+	_, err = (&JWK{Kty: "RSA"}).Key()
+	assert.EqualError(t, err, `missing "n"`)
+}
+
+func TestThumbprint(t *testing.T) {
+	// The example of RFC 7638, section 3.1.
+	jwk := &JWK{
+		Kty: "RSA",
+		E:   "AQAB",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+	}
+	n, _ := decodeInt("n", jwk.N)
+	thumbprint, err := Thumbprint(&rsa.PublicKey{N: n, E: 65537})
+	assert.NoError(t, err)
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", thumbprint)
+}
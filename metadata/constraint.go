@@ -0,0 +1,98 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metadata
+
+import (
+	"regexp"
+	"time"
+)
+
+// Constraint restricts the values a path variable matches, as in
+// :id<int> or :slug<[a-z0-9-]+>. Name is the built-in constraint or the
+// pattern as written in the annotation.
+type Constraint struct {
+	Name  string
+	match func(string) bool
+}
+
+var builtinConstraints = map[string]func(string) bool{
+	"int": func(value string) bool {
+		if len(value) > 1 && (value[0] == '-' || value[0] == '+') {
+			value = value[1:]
+		}
+		return digits(value)
+	},
+	"uint": digits,
+	"alpha": func(value string) bool {
+		for i := 0; i < len(value); i++ {
+			if c := value[i] | 0x20; c < 'a' || c > 'z' {
+				return false
+			}
+		}
+		return value != ""
+	},
+	"uuid": func(value string) bool {
+		if len(value) != 36 {
+			return false
+		}
+		for i := 0; i < len(value); i++ {
+			switch i {
+			case 8, 13, 18, 23:
+				if value[i] != '-' {
+					return false
+				}
+			default:
+				if c := value[i] | 0x20; (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+					return false
+				}
+			}
+		}
+		return true
+	},
+	"date": func(value string) bool {
+		_, err := time.Parse("2006-01-02", value)
+		return err == nil
+	},
+}
+
+func digits(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if value[i] < '0' || value[i] > '9' {
+			return false
+		}
+	}
+	return value != ""
+}
+
+// NewConstraint resolves a built-in constraint by name, or compiles the
+// pattern into a regular expression that has to match the whole value.
+func NewConstraint(pattern string) (*Constraint, error) {
+	if match, ok := builtinConstraints[pattern]; ok {
+		return &Constraint{pattern, match}, nil
+	}
+	expression, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, err
+	}
+	return &Constraint{pattern, expression.MatchString}, nil
+}
+
+func (constraint *Constraint) Match(value string) bool {
+	return constraint.match(value)
+}
+
+func (constraint *Constraint) String() string {
+	return "<" + constraint.Name + ">"
+}
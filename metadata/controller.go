@@ -0,0 +1,84 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metadata
+
+import "fmt"
+
+// ControllerInfo holds the annotations written above a controller type.
+// They apply to every route of the controller: the prefix is prepended to
+// the path of each route, and the directives are shared by all of them.
+type ControllerInfo struct {
+	Annotation string
+	Prefix     *RouteInfo
+	Directives []*DirectiveInfo
+}
+
+// cumulativeDirectives add to the directives of the controller instead of
+// replacing them, so that controller interceptors wrap the ones of a method.
+var cumulativeDirectives = map[string]bool{"use": true}
+
+// Route resolves the route of a method against the controller prefix.
+func (controllerInfo *ControllerInfo) Route(routeInfo *RouteInfo) (*RouteInfo, error) {
+	if controllerInfo == nil || controllerInfo.Prefix == nil {
+		return routeInfo, nil
+	}
+	prefix := controllerInfo.Prefix
+
+	resolved := &RouteInfo{
+		Method:   routeInfo.Method,
+		Path:     append(append(PathList(nil), prefix.Path...), routeInfo.Path...),
+		Query:    routeInfo.Query,
+		Defaults: routeInfo.Defaults,
+		Required: routeInfo.Required,
+	}
+	if len(prefix.Mapping)+len(routeInfo.Mapping) > 0 {
+		resolved.Mapping = make(map[string]*interface{}, len(prefix.Mapping)+len(routeInfo.Mapping))
+	}
+	for variable, value := range prefix.Mapping {
+		resolved.Mapping[variable] = value
+	}
+	for variable, value := range routeInfo.Mapping {
+		if _, ok := resolved.Mapping[variable]; ok {
+			return nil, fmt.Errorf("variable :%s is already declared by the controller prefix %s", variable, prefix.Path)
+		}
+		resolved.Mapping[variable] = value
+	}
+	return resolved, nil
+}
+
+// Merge combines the directives of a method with the ones of the
+// controller. A method directive replaces the controller directive of the
+// same name, except for @use, whose interceptors are appended to the ones
+// of the controller.
+func (controllerInfo *ControllerInfo) Merge(directives []*DirectiveInfo) []*DirectiveInfo {
+	if controllerInfo == nil || len(controllerInfo.Directives) == 0 {
+		return directives
+	}
+
+	overridden := make(map[string]bool, len(directives))
+	for _, directive := range directives {
+		if !cumulativeDirectives[directive.Name] {
+			overridden[directive.Name] = true
+		}
+	}
+
+	var merged []*DirectiveInfo
+	for _, directive := range controllerInfo.Directives {
+		if !overridden[directive.Name] {
+			merged = append(merged, directive)
+		}
+	}
+	return append(merged, directives...)
+}
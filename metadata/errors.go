@@ -0,0 +1,79 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metadata
+
+import (
+	"fmt"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// SyntaxError is an annotation that could not be parsed. Column counts from
+// the start of the annotation as written, comment slashes included; the
+// scanner rebases it on the source file and fills in Filename and Line.
+type SyntaxError struct {
+	Filename string
+	Line     int
+	Column   int
+	Token    string
+	Expected []string
+	Message  string
+}
+
+func (err *SyntaxError) Position() token.Position {
+	return token.Position{Filename: err.Filename, Line: err.Line, Column: err.Column}
+}
+
+// Error renders the error as file:line:col: message, the form editors jump
+// from. Errors of annotations parsed outside a file only carry the message.
+func (err *SyntaxError) Error() string {
+	if err.Line == 0 {
+		return err.Message
+	}
+	return fmt.Sprintf("%s: %s", err.Position(), err.Message)
+}
+
+// ErrorList collects the syntax errors of every annotation of a scan.
+type ErrorList []*SyntaxError
+
+func (list ErrorList) Error() string {
+	messages := make([]string, len(list))
+	for i, err := range list {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (list ErrorList) sort() {
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
+func (list ErrorList) err() error {
+	if len(list) == 0 {
+		return nil
+	}
+	list.sort()
+	return list
+}
@@ -15,11 +15,165 @@
 package metadata
 
 import (
-//"log"
+	"bufio"
+	"fmt"
+	"go/build"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
 )
 
-type Source struct{}
+// Source aggregates the controller annotations of every package in a module.
+// Packages are keyed by import path, or by the directory relative to the
+// root when the tree has no go.mod.
+type Source struct {
+	GoFileRegistry
+	BuildTags []string
+	Module    string
+	Packages  map[string]*GoFileRegistry
+}
+
+// ConflictError reports two handlers that claim the same route.
+type ConflictError struct {
+	Route    string
+	First    *ControllerMethodDescriptor
+	Second   *ControllerMethodDescriptor
+	Distinct bool
+}
+
+func (err *ConflictError) Error() string {
+	kind := "duplicate"
+	if err.Distinct {
+		kind = "conflicting"
+	}
+	return fmt.Sprintf("%s: %s route %s of %s.%s, already declared by %s.%s at %s",
+		err.Second.Position, kind, err.Route, err.Second.Controller, err.Second.Name,
+		err.First.Controller, err.First.Name, err.First.Position)
+}
+
+type ConflictList []*ConflictError
+
+func (list ConflictList) Error() string {
+	switch len(list) {
+	case 0:
+		return "no conflicts"
+	case 1:
+		return list[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more conflicts)", list[0], len(list)-1)
+}
+
+// LoadSourceCode scans the module rooted at path, recursing into every
+// package except vendor, testdata and nested modules. Annotation syntax
+// errors are reported together as an ErrorList, and route conflicts as a
+// ConflictList, after the whole tree has been loaded.
+func (source *Source) LoadSourceCode(root string) error {
+	ctx := build.Default
+	ctx.BuildTags = append(append([]string(nil), ctx.BuildTags...), source.BuildTags...)
+
+	source.Module = modulePath(root)
+	source.Packages = make(map[string]*GoFileRegistry)
+	source.GoFileRegistry = GoFileRegistry{}
+
+	var errs ErrorList
+	err := filepath.WalkDir(root, func(dir string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return err
+		}
+		if dir != root {
+			name := entry.Name()
+			if name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+		}
+
+		gfr, err := scanPackage(&ctx, dir)
+		if list, ok := err.(ErrorList); ok {
+			errs = append(errs, list...)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(gfr.Controllers) == 0 {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			return err
+		}
+		pkg := filepath.ToSlash(rel)
+		if source.Module != "" {
+			pkg = path.Join(source.Module, pkg)
+		}
+		for _, method := range gfr.ControllerMethods {
+			if source.Module != "" {
+				method.Package = pkg
+			}
+			source.add(method)
+		}
+		source.Controllers = append(source.Controllers, gfr.Controllers...)
+		source.Packages[pkg] = gfr
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := errs.err(); err != nil {
+		return err
+	}
+
+	return source.conflicts()
+}
+
+func (source *Source) conflicts() error {
+	var list ConflictList
+
+	declared := make(map[string]*ControllerMethodDescriptor)
+	for _, method := range source.ControllerMethods {
+		routeInfo := method.Info.Info.(*RouteInfo)
+		for _, name := range MethodNames(routeInfo.Method) {
+			key := name + " " + routeInfo.Path.pattern()
+
+			if first, ok := declared[key]; ok {
+				firstInfo := first.Info.Info.(*RouteInfo)
+				list = append(list, &ConflictError{
+					Route:    name + " " + routeInfo.Path.String(),
+					First:    first,
+					Second:   method,
+					Distinct: firstInfo.Path.String() != routeInfo.Path.String(),
+				})
+				break
+			}
+			declared[key] = method
+		}
+	}
+
+	if len(list) > 0 {
+		return list
+	}
+	return nil
+}
 
-func (source *Source) LoadSourceCode(path string) {
+func modulePath(root string) string {
+	f, err := os.Open(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
 
+	lines := bufio.NewScanner(f)
+	for lines.Scan() {
+		fields := strings.Fields(lines.Text())
+		if len(fields) == 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	return ""
 }
@@ -0,0 +1,116 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTree(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+	for name, content := range files {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		assert.NoError(t, os.WriteFile(file, []byte(content), 0644))
+	}
+	return root
+}
+
+func TestLoadSourceCodeAcrossPackages(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"go.mod": "module example.com/shop\n",
+		"customers/customers.go": `package customers
+			type Customers winter.Controller
+			//> GET /customers/:id
+			func (c *Customers) Get(id string, //> :id
+			) {}`,
+		"customers/customers_test.go": `package customers
+			//> GET /customers/:id
+			func (c *Customers) TestOnly() {}`,
+		"orders/orders.go": `package orders
+			type Orders winter.Controller
+			//> GET /orders/:id
+			func (o *Orders) Get(id string, //> :id
+			) {}`,
+		"orders/orders_tagged.go": `//go:build enterprise
+
+			package orders
+			//> DELETE /orders/:id
+			func (o *Orders) Delete(id string, //> :id
+			) {}`,
+		"vendor/other/other.go": `package other
+			type Other winter.Controller
+			//> GET /other
+			func (o *Other) Get() {}`,
+	})
+
+	source := new(Source)
+	assert.NoError(t, source.LoadSourceCode(root))
+
+	assert.Equal(t, "example.com/shop", source.Module)
+	assert.Equal(t, []string{"Customers", "Orders"}, source.Controllers)
+	assert.Len(t, source.ControllerMethods, 2)
+	assert.Contains(t, source.Packages, "example.com/shop/orders")
+	assert.Equal(t, "example.com/shop/customers", source.ControllerMethods[0].Package)
+
+	tagged := &Source{BuildTags: []string{"enterprise"}}
+	assert.NoError(t, tagged.LoadSourceCode(root))
+	assert.Len(t, tagged.ControllerMethods, 3)
+}
+
+func TestLoadSourceCodeConflicts(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"a/a.go": `package a
+			type A winter.Controller
+			//> GET /customers/:id
+			func (a *A) Get(id string, //> :id
+			) {}
+			//> GET /customers
+			func (a *A) List() {}`,
+		"b/b.go": `package b
+			type B winter.Controller
+			//> GET /customers/:name
+			func (b *B) Get(name string, //> :name
+			) {}
+			//> GET /customers
+			func (b *B) List() {}`,
+	})
+
+	err := new(Source).LoadSourceCode(root)
+	assert.IsType(t, ConflictList{}, err)
+
+	conflicts := err.(ConflictList)
+	assert.Len(t, conflicts, 2)
+	assert.True(t, conflicts[0].Distinct)
+	assert.False(t, conflicts[1].Distinct)
+	assert.Contains(t, conflicts[0].Error(), "conflicting route GET /customers/:name of B.Get")
+}
+
+func TestLoadSourceCodeCollectsSyntaxErrors(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"a/a.go": "package a\ntype A winter.Controller\n//> GET /a/:\nfunc (a *A) Get() {}\n",
+		"b/b.go": "package b\ntype B winter.Controller\n//> GET /b/*\nfunc (b *B) Get() {}\n",
+	})
+
+	err := new(Source).LoadSourceCode(root)
+	assert.IsType(t, ErrorList{}, err)
+	assert.Len(t, err.(ErrorList), 2)
+	assert.Equal(t, 3, err.(ErrorList)[1].Line)
+	assert.Contains(t, err.(ErrorList)[1].Filename, "b.go")
+}
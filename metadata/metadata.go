@@ -14,6 +14,8 @@
 
 package metadata
 
+import "strings"
+
 type Metadata struct {
 	Type        MetadataType
 	Info        interface{}
@@ -28,12 +30,51 @@ type MultiVariableInfo struct {
 	Names []string
 }
 
+// DirectiveInfo is an annotation such as @use RateLimit, AuditLog that
+// configures the routes of a method or of a whole controller.
+type DirectiveInfo struct {
+	Name      string
+	Arguments []string
+}
+
+// RouteDirectives are the directives of controllers and methods, and
+// ParameterDirectives the ones that bind a parameter. Any other name is
+// reported by the scanner.
+var (
+	RouteDirectives     = map[string]bool{"use": true, "maxbody": true, "strict": true, "auth": true, "produces": true}
+	ParameterDirectives = map[string]bool{"body": true, "header": true, "cookie": true, "remote": true}
+)
+
+// misplaced returns why the directive cannot annotate a route, or a
+// parameter when parameter is set, and "" when it can.
+func (directiveInfo *DirectiveInfo) misplaced(parameter bool) string {
+	name := directiveInfo.Name
+	switch {
+	case !RouteDirectives[name] && !ParameterDirectives[name]:
+		return "Unknown directive @" + name
+	case parameter && !ParameterDirectives[name]:
+		return "@" + name + " cannot annotate a parameter"
+	case !parameter && !RouteDirectives[name]:
+		return "@" + name + " can only annotate a parameter"
+	}
+	return ""
+}
+
+func (directiveInfo *DirectiveInfo) String() string {
+	if len(directiveInfo.Arguments) == 0 {
+		return "@" + directiveInfo.Name
+	}
+	return "@" + directiveInfo.Name + " " + strings.Join(directiveInfo.Arguments, ", ")
+}
+
 type MetadataType int
 
 const (
 	Route MetadataType = iota
 	Variable
 	MultiVariable
+	Prefix
+	Directive
 )
 
 func NewMetadata(metaDataType MetadataType, routeInfos ...RouteInfo) *Metadata {
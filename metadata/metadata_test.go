@@ -15,6 +15,7 @@
 package metadata
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -111,3 +112,231 @@ func TestRouteExtractionWithQuery(t *testing.T) {
 	queries := meta.Info.(*RouteInfo).Query
 	assert.Equal(t, []string{"token", "customized"}, queries)
 }
+
+func TestRouteParsedAdditionalHttpMethods(t *testing.T) {
+	for keyword, expected := range map[string]HttpMethod{
+		"PATCH":    Patch{},
+		"HEAD":     Head{},
+		"OPTIONS":  Options{},
+		"ANY":      Any{},
+		"PROPFIND": CustomMethod("PROPFIND"),
+	} {
+		meta, err := ParseMetadata("> " + keyword + " /files/:name")
+		assert.NoError(t, err)
+		assert.Equal(t, expected, meta.Info.(*RouteInfo).Method)
+		assert.Equal(t, keyword, ToStringOfHttpMethod(meta.Info.(*RouteInfo).Method))
+	}
+}
+
+func TestRouteParsedMultipleHttpMethods(t *testing.T) {
+	meta, err := ParseMetadata("> GET|HEAD /files/:name")
+	assert.NoError(t, err)
+
+	method := meta.Info.(*RouteInfo).Method
+	assert.Equal(t, Methods{Get{}, Head{}}, method)
+	assert.Equal(t, []string{"GET", "HEAD"}, MethodNames(method))
+	assert.Equal(t, "/files/:name", meta.Info.(*RouteInfo).Path.String())
+}
+
+func TestMisplacedMethodSeparator(t *testing.T) {
+	_, err := ParseMetadata("> GET /files | HEAD")
+	assert.EqualError(t, err, "Syntax error. Use of '|' is only valid between Http Methods")
+}
+
+func TestLowerCaseCustomMethod(t *testing.T) {
+	_, err := ParseMetadata("> propfind /files")
+	assert.EqualError(t, err, "Expected an Http Method before a path")
+}
+
+func TestRouteParsedCatchAll(t *testing.T) {
+	meta, err := ParseMetadata("> GET /static/*filepath")
+	assert.NoError(t, err)
+
+	routeInfo := meta.Info.(*RouteInfo)
+	assert.Equal(t, "/static/*filepath", routeInfo.Path.String())
+	assert.IsType(t, CatchAll{}, routeInfo.Path[1])
+	_, hasKey := routeInfo.Mapping["filepath"]
+	assert.True(t, hasKey)
+}
+
+func TestRouteParsedLiteralSegments(t *testing.T) {
+	for annotation, path := range map[string]string{
+		"> GET /health-check":            "/health-check",
+		"> GET /api/2017/reports":        "/api/2017/reports",
+		"> GET /.well-known/jwks.json":   "/.well-known/jwks.json",
+		"> GET /v1.2/~user_files/:id":    "/v1.2/~user_files/:id",
+		"> GET /reports/2017.05 ? :page": "/reports/2017.05",
+	} {
+		meta, err := ParseMetadata(annotation)
+		assert.NoError(t, err, annotation)
+		assert.Equal(t, path, meta.Info.(*RouteInfo).Path.String(), annotation)
+	}
+}
+
+func TestUnexpectedTokens(t *testing.T) {
+	for annotation, message := range map[string]string{
+		"> GET /files/:name.json": "1:19: Syntax error. Unexpected token",
+		"> GET /files/:name-raw":  "1:19: Syntax error. Unexpected token",
+		"> GET /files/:name 2017": "1:20: Syntax error. Unexpected token",
+		"> GET /files names":      "1:14: Syntax error. Unexpected token",
+		"> GET customers":         "1:7: Syntax error. Unexpected token",
+		"> GET /files/<int>":      "1:14: Syntax error. Unexpected token",
+		"> GET /a+b":              "1:8: Syntax error. Unexpected character + in a path segment",
+		"> GET /files ? :page 2":  "1:22: Syntax error. Unexpected token",
+	} {
+		_, err := ParseMetadata(annotation)
+		assert.IsType(t, &SyntaxError{}, err, annotation)
+		if syntaxError, ok := err.(*SyntaxError); ok {
+			assert.Equal(t, message, fmt.Sprintf("%d:%d: %s", 1, syntaxError.Column, syntaxError.Message), annotation)
+			assert.NotEmpty(t, syntaxError.Expected, annotation)
+		}
+	}
+}
+
+func TestCatchAllMustEndPath(t *testing.T) {
+	_, err := ParseMetadata("> GET /static/*filepath/raw")
+	assert.EqualError(t, err, "Syntax error. A catch-all variable must be the last segment of a path")
+
+	for _, annotation := range []string{
+		"> GET /static/*path<int>",
+		"> GET /static/*path.json",
+		"> GET /static/*path-raw",
+		"> GET /static/*path raw",
+		"> GET /static/*path:name",
+	} {
+		_, err := ParseMetadata(annotation)
+		assert.IsType(t, &SyntaxError{}, err, annotation)
+		assert.EqualError(t, err, "Syntax error. A catch-all variable must be the last segment of a path", annotation)
+	}
+
+	meta, err := ParseMetadata("> GET /static/*path ? :version")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"version"}, meta.Info.(*RouteInfo).Query)
+}
+
+func TestRouteParsedOptionalSegment(t *testing.T) {
+	meta, err := ParseMetadata("> GET /reports/:year/:month? ? :format")
+	assert.NoError(t, err)
+
+	routeInfo := meta.Info.(*RouteInfo)
+	assert.Equal(t, "/reports/:year/:month?", routeInfo.Path.String())
+	assert.False(t, routeInfo.Path[1].(Entry).Optional())
+	assert.True(t, routeInfo.Path[2].(Entry).Optional())
+	assert.Equal(t, []string{"format"}, routeInfo.Query)
+}
+
+func TestOptionalSegmentMustBeTrailing(t *testing.T) {
+	_, err := ParseMetadata("> GET /reports/:year?/summary")
+	assert.EqualError(t, err, "Syntax error. Only the last segments of a path can be optional")
+}
+
+func TestRouteParsedConstraints(t *testing.T) {
+	meta, err := ParseMetadata("> GET /orders/:id<int>/lines/:slug<[a-z0-9-]+>?")
+	assert.NoError(t, err)
+
+	routeInfo := meta.Info.(*RouteInfo)
+	assert.Equal(t, "/orders/:id<int>/lines/:slug<[a-z0-9-]+>?", routeInfo.Path.String())
+
+	id := routeInfo.Path[1].(Entry).Constraint()
+	assert.True(t, id.Match("-42"))
+	assert.False(t, id.Match("4a"))
+
+	slug := routeInfo.Path[3].(Entry).Constraint()
+	assert.True(t, slug.Match("winter-2017"))
+	assert.False(t, slug.Match("Winter"))
+	assert.True(t, routeInfo.Path[3].(Entry).Optional())
+}
+
+func TestBuiltinConstraints(t *testing.T) {
+	for name, values := range map[string][2]string{
+		"uint":  {"42", "-42"},
+		"alpha": {"Winter", "winter2"},
+		"uuid":  {"123e4567-e89b-12d3-a456-426655440000", "123e4567e89b12d3a456426655440000"},
+		"date":  {"2017-02-28", "2017-02-30"},
+	} {
+		constraint, err := NewConstraint(name)
+		assert.NoError(t, err)
+		assert.True(t, constraint.Match(values[0]), "%s %s", name, values[0])
+		assert.False(t, constraint.Match(values[1]), "%s %s", name, values[1])
+	}
+}
+
+func TestUnterminatedConstraint(t *testing.T) {
+	_, err := ParseMetadata("> GET /orders/:id<int")
+	assert.EqualError(t, err, "Syntax error. Expected '>' to close the constraint of :id")
+}
+
+func TestInvalidConstraintPattern(t *testing.T) {
+	_, err := ParseMetadata("> GET /orders/:id<[0-9>")
+	assert.Error(t, err)
+}
+
+func TestSyntaxErrorPosition(t *testing.T) {
+	_, err := ParseMetadata("//> GET /orders/:id<int/lines")
+
+	syntaxError := err.(*SyntaxError)
+	assert.Equal(t, 20, syntaxError.Column)
+	assert.Equal(t, "<int/lines", syntaxError.Token)
+	assert.Equal(t, []string{"'>'"}, syntaxError.Expected)
+	assert.Equal(t, "Syntax error. Expected '>' to close the constraint of :id", syntaxError.Error())
+}
+
+func TestControllerPrefix(t *testing.T) {
+	meta, err := ParseMetadata("> /customers/:customer")
+	assert.NoError(t, err)
+	assert.Equal(t, Prefix, meta.Type)
+	assert.Nil(t, meta.Info.(*RouteInfo).Method)
+	assert.Equal(t, "/customers/:customer", meta.Info.(*RouteInfo).Path.String())
+
+	_, err = ParseMetadata("> /customers ? :page")
+	assert.EqualError(t, err, "Syntax error. A controller prefix cannot declare query arguments")
+
+	_, err = ParseMetadata("> /files/*path")
+	assert.Error(t, err)
+}
+
+func TestDirective(t *testing.T) {
+	meta, err := ParseMetadata("//> @use RateLimit, AuditLog")
+	assert.NoError(t, err)
+	assert.Equal(t, Directive, meta.Type)
+	assert.Equal(t, &DirectiveInfo{"use", []string{"RateLimit", "AuditLog"}}, meta.Info)
+	assert.Equal(t, "@use RateLimit, AuditLog", meta.Info.(*DirectiveInfo).String())
+
+	_, err = ParseMetadata("> @")
+	assert.EqualError(t, err, "Syntax error. Expected a directive name after '@'")
+}
+
+func TestQueryDefaultsAndRequired(t *testing.T) {
+	meta, err := ParseMetadata("> GET /orders ? :page=1 :size=20 :filter! :sort=-created_at")
+	assert.NoError(t, err)
+
+	routeInfo := meta.Info.(*RouteInfo)
+	assert.Equal(t, []string{"page", "size", "filter", "sort"}, routeInfo.Query)
+	assert.Equal(t, map[string]string{"page": "1", "size": "20", "sort": "-created_at"}, routeInfo.Defaults)
+	assert.Equal(t, map[string]bool{"filter": true}, routeInfo.Required)
+}
+
+func TestQueryDefaultErrors(t *testing.T) {
+	_, err := ParseMetadata("> GET /orders ? :page=")
+	assert.EqualError(t, err, "Syntax error. Expected a default value after '='")
+
+	_, err = ParseMetadata("> GET /orders ? :page!=1")
+	assert.EqualError(t, err, "Syntax error. A query argument cannot be both required and defaulted")
+
+	_, err = ParseMetadata("> GET /orders/:id! ? :page")
+	assert.EqualError(t, err, "Syntax error. Use of '!' is only valid after a query argument")
+}
+
+func TestMalformedAnnotationsAreErrors(t *testing.T) {
+	for line, message := range map[string]string{
+		"> ? :a":          "Syntax error. Use of '?' is only valid after a path",
+		"> ::a":           "Syntax error. Expected an identifier after ':'",
+		"> :a ? :b":       "Syntax error. Use of '?' is only valid after a path",
+		"> :a b":          "Syntax error. Expected ':' before the identifier of a variable",
+		"> GET /a ? ? :b": "Syntax error. Use of '?' is only valid after a path",
+	} {
+		_, err := ParseMetadata(line)
+		assert.IsType(t, &SyntaxError{}, err, line)
+		assert.EqualError(t, err, message, line)
+	}
+}
@@ -17,6 +17,7 @@ package metadata
 import (
 	"strings"
 	"text/scanner"
+	"unicode"
 )
 
 type state uint8
@@ -39,15 +40,48 @@ const (
 	ExpectArguments
 )
 
+var httpMethods = []string{"GET", "POST", "PUT", "DELETE", "PATCH", "HEAD", "OPTIONS", "ANY"}
+
 func ParseMetadata(line string) (meta *Metadata, err error) {
 
 	currentState := Begin
 	expectedState := NoneExpected
 
-	line = strings.TrimLeft(strings.TrimSpace(line), "/")
+	trimmed := strings.TrimLeft(strings.TrimSpace(line), "/")
+	leading := strings.Index(line, trimmed)
 
 	var s scanner.Scanner
-	s.Init(strings.NewReader(line))
+	s.Init(strings.NewReader(trimmed))
+	s.Mode &^= scanner.ScanComments | scanner.SkipComments // "/*" starts a catch-all
+
+	failAt := func(offset int, token string, message string, expected ...string) error {
+		if offset >= len(trimmed) {
+			token = "EOF"
+		}
+		return &SyntaxError{
+			Column:   leading + offset + 1,
+			Token:    token,
+			Expected: expected,
+			Message:  message,
+		}
+	}
+	fail := func(message string, expected ...string) error {
+		return failAt(s.Position.Offset, s.TokenText(), message, expected...)
+	}
+
+	// segment reads a literal segment of a path, from the token just
+	// scanned up to the next '/', '?' or space.
+	segment := func(meta *Metadata) error {
+		offset := s.Position.Offset
+		text := s.TokenText() + scanSegment(&s)
+		for _, r := range text {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("-._~", r) {
+				return failAt(offset, text, "Syntax error. Unexpected character "+string(r)+" in a path segment", "letter", "digit", "'-'", "'.'", "'_'", "'~'")
+			}
+		}
+		meta.Info.(*RouteInfo).ConcatenatePath(text)
+		return nil
+	}
 
 	var tok rune
 
@@ -55,27 +89,99 @@ func ParseMetadata(line string) (meta *Metadata, err error) {
 		currentState = DeclaratorSymbol
 
 		for currentState < End && err == nil {
+			end := s.Pos().Offset
+			previous := tok
 			tok = s.Scan()
 
+			// Nothing but the query statement may follow a catch-all.
+			if currentState == PathExpression && tok != '?' && tok != scanner.EOF {
+				if path := meta.Info.(*RouteInfo).Path; len(path) > 0 && isCatchAll(path[len(path)-1]) {
+					err = fail("Syntax error. A catch-all variable must be the last segment of a path", "'?'", "EOF")
+					break
+				}
+			}
+
 			operator := tok
 
 			switch operator {
 			case '/':
-				if meta.Type != Route {
-					err = NewError("Syntax error. Use of '/' is only valid for Path declaration")
+				if meta == nil && currentState == DeclaratorSymbol {
+					// A path without a method prefixes the routes of a controller.
+					meta = NewMetadata(Prefix, NewRouteInfo(nil))
+					currentState = PathExpression
+					expectedState = ExpectIdentifier
+				} else if meta == nil || meta.Type != Route && meta.Type != Prefix {
+					err = fail("Syntax error. Use of '/' is only valid for Path declaration")
 				} else if currentState == QuerySymbol {
-					err = NewError("Syntax error. Use only identifiers in the query statement")
+					err = fail("Syntax error. Use only identifiers in the query statement", "':'", "identifier")
+				} else {
+					expectedState = ExpectIdentifier
+				}
+			case '*':
+				if currentState != PathExpression || expectedState != ExpectIdentifier {
+					err = fail("Syntax error. Use of '*' is only valid at the start of a path segment")
+				} else if s.Scan() != scanner.Ident {
+					err = fail("Syntax error. Expected an identifier after '*'", "identifier")
 				} else {
+					meta.Info.(*RouteInfo).ConcatenateCatchAll(s.TokenText())
+					expectedState = NoneExpected
+				}
+			case '|':
+				if currentState != PathExpression || expectedState != ExpectPath {
+					err = fail("Syntax error. Use of '|' is only valid between Http Methods", "'/'")
+				} else {
+					currentState = DeclaratorSymbol
 					expectedState = ExpectIdentifier
 				}
 			case '?':
-				currentState = QuerySymbol
+				// A '?' written right after a path variable makes it optional;
+				// anything else starts the query statement.
+				if currentState == PathExpression && s.Position.Offset == end && meta.Info.(*RouteInfo).MarkOptional() {
+					break
+				}
+				if meta == nil || meta.Type != Route && meta.Type != Prefix || currentState != PathExpression {
+					err = fail("Syntax error. Use of '?' is only valid after a path")
+				} else if meta.Type == Prefix {
+					err = fail("Syntax error. A controller prefix cannot declare query arguments")
+				} else {
+					currentState = QuerySymbol
+				}
+			case '=':
+				if currentState != QuerySymbol || previous != scanner.Ident && previous != '!' || s.Position.Offset != end {
+					err = fail("Syntax error. Use of '=' is only valid after a query argument")
+				} else if value := scanValue(&s); value == "" {
+					err = fail("Syntax error. Expected a default value after '='", "value")
+				} else if !meta.Info.(*RouteInfo).SetDefault(value) {
+					err = fail("Syntax error. A query argument cannot be both required and defaulted")
+				}
+			case '!':
+				if currentState != QuerySymbol || previous != scanner.Ident || s.Position.Offset != end {
+					err = fail("Syntax error. Use of '!' is only valid after a query argument")
+				} else if !meta.Info.(*RouteInfo).Require() {
+					err = fail("Syntax error. A query argument cannot be both required and defaulted")
+				}
+			case '@':
+				if currentState != DeclaratorSymbol || meta != nil {
+					err = fail("Syntax error. Use of '@' is only valid at the start of an annotation")
+				} else if s.Scan() != scanner.Ident {
+					err = fail("Syntax error. Expected a directive name after '@'", "identifier")
+				} else {
+					meta = &Metadata{Type: Directive, Info: &DirectiveInfo{
+						Name:      s.TokenText(),
+						Arguments: directiveArguments(trimmed[s.Pos().Offset:]),
+					}}
+					currentState = End
+				}
 			case ':':
+				if previous == ':' {
+					err = fail("Syntax error. Expected an identifier after ':'", "identifier")
+					break
+				}
 				expectedState = ExpectIdentifier
 				switch currentState {
 				case DeclaratorSymbol:
 					if meta != nil { //
-						err = NewError("Bug error. Expected none declared identifiers.")
+						err = fail("Bug error. Expected none declared identifiers.")
 					}
 
 					meta = NewMetadata(Variable)
@@ -83,11 +189,14 @@ func ParseMetadata(line string) (meta *Metadata, err error) {
 					currentState = VariableTerm
 				case PathExpression:
 					if s.Scan() != scanner.Ident {
-						err = NewError("Syntax error. Expected an identifier or variable in your route declaration")
+						err = fail("Syntax error. Expected an identifier or variable in your route declaration", "identifier")
 					} else {
 						identifier := s.TokenText()
 						meta.Info.(*RouteInfo).ConcatenatePathVariable(identifier)
 						expectedState = NoneExpected
+						if s.Peek() == '<' {
+							err = scanConstraint(&s, meta.Info.(*RouteInfo), identifier, failAt)
+						}
 					}
 				case VariableTerm:
 					if meta.Type != MultiVariable {
@@ -97,7 +206,7 @@ func ParseMetadata(line string) (meta *Metadata, err error) {
 				case QuerySymbol:
 					expectedState = ExpectArguments
 				default:
-					err = NewError("Syntax error using ':'")
+					err = fail("Syntax error using ':'")
 				}
 			case scanner.Ident:
 				if expectedState == ExpectIdentifier {
@@ -105,7 +214,9 @@ func ParseMetadata(line string) (meta *Metadata, err error) {
 				}
 				switch currentState {
 				case VariableTerm:
-					if meta.Type == MultiVariable {
+					if previous != ':' {
+						err = fail("Syntax error. Expected ':' before the identifier of a variable", "':'")
+					} else if meta.Type == MultiVariable {
 						multiVariableInfo := meta.Info.(*MultiVariableInfo)
 						multiVariableInfo.addMultiVariableInfo(s.TokenText())
 					} else {
@@ -117,32 +228,48 @@ func ParseMetadata(line string) (meta *Metadata, err error) {
 					httpMethod := ToHttpMethod(keyword)
 
 					switch httpMethod.(type) {
-					case Get:
-					case Post:
-					case Put:
-					case Delete:
-					default:
-						err = NewError("Expected an Http Method before a path")
+					case IncompatibleMethod:
+						err = fail("Expected an Http Method before a path", httpMethods...)
 					}
 
 					expectedState = ExpectPath
 					currentState = PathExpression
 
-					routeInfo := NewRouteInfo(httpMethod)
-
-					meta = NewMetadata(Route, routeInfo)
+					if meta != nil {
+						meta.Info.(*RouteInfo).AddMethod(httpMethod)
+					} else {
+						routeInfo := NewRouteInfo(httpMethod)
 
-					//nextKeyword := s.TokenText()
+						meta = NewMetadata(Route, routeInfo)
+					}
 				case PathExpression:
-					meta.Info.(*RouteInfo).ConcatenatePath(s.TokenText())
+					if previous != '/' {
+						err = fail("Syntax error. Unexpected token", expected(currentState)...)
+					} else {
+						err = segment(meta)
+					}
 				case PathExpression | VariableTerm:
 					meta.Info.(*RouteInfo).ConcatenatePathVariable(s.TokenText())
 				case QuerySymbol:
 					expectedState = ExpectArguments | NoneExpected
 					meta.Info.(*RouteInfo).AddArgument(s.TokenText())
 				}
+			case scanner.Int, scanner.Float, '-', '.', '~':
+				// Segments such as 2017, .well-known or health-check.
+				if currentState != PathExpression || previous != '/' {
+					err = fail("Syntax error. Unexpected token", expected(currentState)...)
+				} else {
+					err = segment(meta)
+					expectedState = NoneExpected
+				}
 			case scanner.EOF:
 				currentState = End
+				// A path may end with '/', as the root of a controller prefix.
+				if previous == '/' && expectedState == ExpectIdentifier {
+					expectedState = NoneExpected
+				}
+			default:
+				err = fail("Syntax error. Unexpected token", expected(currentState)...)
 			}
 
 		}
@@ -150,13 +277,116 @@ func ParseMetadata(line string) (meta *Metadata, err error) {
 		return
 	}
 
+	if err == nil && meta != nil && meta.Type == Route && !trailingOptionals(meta.Info.(*RouteInfo).Path) {
+		err = fail("Syntax error. Only the last segments of a path can be optional")
+	}
+
+	if err == nil && meta != nil && meta.Type == Prefix {
+		for _, element := range meta.Info.(*RouteInfo).Path {
+			if entry, ok := element.(Entry); ok && entry.Optional() || isCatchAll(element) {
+				err = fail("Syntax error. A controller prefix cannot end its routes with optional or catch-all variables")
+			}
+		}
+	}
+
 	if err == nil && expectedState&ExpectIdentifier > 0 {
 		if expectedState == ExpectIdentifier {
-			err = NewError("Syntax error. Expected an identifier after ':'")
+			err = fail("Syntax error. Expected an identifier after ':'", "identifier")
 		} else {
-			err = NewError("Syntax error.")
+			err = fail("Syntax error.")
 		}
 	}
 
 	return
 }
+
+// scanValue reads the raw text of a default value up to the next space.
+func scanValue(s *scanner.Scanner) string {
+	var value []rune
+	for ch := s.Peek(); ch != scanner.EOF && !unicode.IsSpace(ch); ch = s.Peek() {
+		value = append(value, s.Next())
+	}
+	return string(value)
+}
+
+// scanSegment reads the raw text of a path segment up to the next '/', '?'
+// or space.
+func scanSegment(s *scanner.Scanner) string {
+	var text []rune
+	for ch := s.Peek(); ch != scanner.EOF && ch != '/' && ch != '?' && !unicode.IsSpace(ch); ch = s.Peek() {
+		text = append(text, s.Next())
+	}
+	return string(text)
+}
+
+// expected lists the tokens that can follow in the given state.
+func expected(currentState state) []string {
+	switch currentState {
+	case DeclaratorSymbol:
+		return append([]string{"'/'", "':'", "'@'"}, httpMethods...)
+	case PathExpression:
+		return []string{"'/'", "'?'", "EOF"}
+	case QuerySymbol, VariableTerm:
+		return []string{"':'", "EOF"}
+	}
+	return []string{"EOF"}
+}
+
+// directiveArguments splits the rest of a directive on commas and spaces,
+// so that @use RateLimit, AuditLog and @use RateLimit AuditLog agree.
+func directiveArguments(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
+func isCatchAll(element interface{}) bool {
+	_, ok := element.(CatchAll)
+	return ok
+}
+
+func trailingOptionals(path PathList) bool {
+	optional := false
+	for _, element := range path {
+		entry, ok := element.(Entry)
+		if optional && (!ok || !entry.Optional()) {
+			return false
+		}
+		optional = ok && entry.Optional()
+	}
+	return true
+}
+
+// scanConstraint reads the raw text between '<' and its matching '>' as the
+// constraint of the variable just declared. Brackets may nest so that
+// patterns like (?P<name>...) stay intact.
+func scanConstraint(s *scanner.Scanner, routeInfo *RouteInfo, variable string,
+	failAt func(int, string, string, ...string) error) error {
+
+	offset := s.Pos().Offset
+	s.Next()
+
+	var pattern []rune
+	for depth := 1; ; {
+		ch := s.Next()
+		switch ch {
+		case scanner.EOF:
+			return failAt(offset, "<"+string(pattern), "Syntax error. Expected '>' to close the constraint of :"+variable, "'>'")
+		case '<':
+			depth++
+		case '>':
+			depth--
+		}
+		if depth == 0 {
+			break
+		}
+		pattern = append(pattern, ch)
+	}
+
+	constraint, err := NewConstraint(string(pattern))
+	if err != nil {
+		return failAt(offset, "<"+string(pattern)+">", "Syntax error. Invalid constraint of :"+variable+": "+err.Error())
+	}
+	routeInfo.Constrain(constraint)
+	return nil
+}
@@ -15,167 +15,240 @@
 package metadata
 
 import (
-	//"github.com/stretchr/testify/assert"
-	"fmt"
-	"go/ast"
 	"go/parser"
 	"go/token"
-	"strings"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
-type GoFileRegistry struct {
-	Controller        string
-	ControllerMethods []*ControllerMethodDescriptor
-}
+const controllerSource = `
+	package main
 
-type InterpreterMemory struct {
-	fset    ast.CommentMap
-	current *ControllerMethodDescriptor
-	stored  *GoFileRegistry
-}
+	type Login winter.Controller
+	type Salaag winter.Controller
 
-type ControllerMethodDescriptor struct {
-	name          string
-	Info          *Metadata
-	Variables     map[string]*Metadata
-	VariableTypes map[string]string
-}
+	type Unrelated struct{}
 
-func (gfr *GoFileRegistry) add(cmd *ControllerMethodDescriptor) (err error) {
-	if gfr.ControllerMethods == nil {
-		gfr.ControllerMethods = make([]*ControllerMethodDescriptor, 0)
+	//kkk
+	//> GET /customers/:id
+	func (login *Login) GetCustomer(
+		id uint32, //> :id
+		token string, //> :token
+		coordinates string, //> :coordinates
+	) (response winter.Response, err winter.Error) {
+		return
+	}
+
+	//> GET /emails/:email
+	func (login *Login) GetEmail(
+		email string, //> :email
+	) (response winter.Response, err winter.Error) {
+		return
 	}
-	gfr.ControllerMethods = append(gfr.ControllerMethods, cmd)
-	return
-}
 
-type VisitorFunc func(n ast.Node) ast.Visitor
-
-func (f VisitorFunc) Visit(n ast.Node) ast.Visitor { return f(n) }
-
-func (mdr *InterpreterMemory) Interpret(n ast.Node) ast.Visitor {
-	switch n := n.(type) {
-	case *ast.CommentGroup:
-	case *ast.Comment:
-		if mdr.current.Info == nil {
-			var err error
-			mdr.current.Info, err = ParseMetadata(n.Text)
-			if err != nil {
-				panic(err)
-			}
-		}
-	case *ast.FuncDecl:
-		method := new(ControllerMethodDescriptor)
-		method.name = n.Name.Name
-		method.Variables = make(map[string]*Metadata)
-		mdr.current = method
-	case *ast.FuncType:
-		mdr.current.Variables = make(map[string]*Metadata, n.Params.NumFields())
-		mdr.current.VariableTypes = make(map[string]string, n.Params.NumFields())
-		for _, f := range n.Params.List {
-			for _, name := range f.Names {
-				for _, decField := range mdr.fset.Filter(f) {
-					variable, err := ParseMetadata(decField[0].List[0].Text)
-					if err != nil {
-						panic(err)
-					} else {
-						if variable != nil {
-							mdr.current.Variables[name.Name] = variable
-							mdr.current.VariableTypes[name.Name] = f.Type.(*ast.Ident).Name
-						}
-					}
-				}
-
-			}
-		}
-	case *ast.BlockStmt:
-		mdr.stored.add(mdr.current)
-		mdr.current = nil
-		return nil
+	//> GET /ignored
+	func (unrelated *Unrelated) Ignored() {
 	}
-	return VisitorFunc(mdr.Interpret)
+	`
+
+func TestParseComments(t *testing.T) {
+	gfr, err := ScanFile("controller.go", controllerSource)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"Login", "Salaag"}, gfr.Controllers)
+	assert.Len(t, gfr.ControllerMethods, 2)
+
+	method := gfr.ControllerMethods[0]
+	assert.Equal(t, "Login", method.Controller)
+	assert.Equal(t, "GetCustomer", method.Name)
+	assert.Equal(t, "/customers/:id", method.Info.Info.(*RouteInfo).Path.String())
+	assert.Equal(t, []string{"id", "token", "coordinates"}, method.Parameters)
+	assert.Equal(t, "id", method.Variables["id"].Info.(*VariableInfo).Name)
+	assert.Equal(t, "uint32", method.VariableTypes["id"])
+	assert.Equal(t, 11, method.Position.Line)
 }
 
-func (mdr InterpreterMemory) String() string {
+func TestScanControllerWithImportAlias(t *testing.T) {
+	gfr, err := ScanFile("controller.go", `
+	package main
 
-	gfr := mdr.stored
-	name := gfr.Controller
-	methods := gfr.ControllerMethods
+	import w "github.com/rrborja/winter"
 
-	methodInfo := make([]string, len(methods))
-	vars := make([][]string, len(methods))
+	type Login struct {
+		w.Controller
+	}
+
+	//> POST /login
+	func (login *Login) Login() {
+	}
+	`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Login"}, gfr.Controllers)
+	assert.Len(t, gfr.ControllerMethods, 1)
+}
 
-	for i, method := range methods {
+func TestScanErrorPosition(t *testing.T) {
+	_, err := ScanFile("controller.go", `
+	package main
 
-		methodSignature := method.Info
-		variables := method.Variables
+	type Login winter.Controller
 
-		routeInfo := methodSignature.Info.(*RouteInfo)
-		httpMethod := routeInfo.Method
-		httpPath := routeInfo.Path
+	//> GET /customers/:id
+	func (login *Login) GetCustomer(
+		id uint32, //> :
+	) {
+	}
+	`)
+	assert.EqualError(t, err, "controller.go:8:19: Syntax error. Expected an identifier after ':'")
 
-		methodInfo[i] = fmt.Sprintf("\tHandler:\t%s\n\t  Route:\t%s %s", method.name, ToStringOfHttpMethod(httpMethod), httpPath)
+	syntaxError := err.(ErrorList)[0]
+	assert.Equal(t, "EOF", syntaxError.Token)
+	assert.Equal(t, []string{"identifier"}, syntaxError.Expected)
+}
 
-		vars[i] = make([]string, len(variables))
+func TestScanReportsEveryError(t *testing.T) {
+	_, err := ScanFile("controller.go", `
+	package main
 
-		j := 0
-		for name, variable := range variables {
-			variableInfo := variable.Info.(*VariableInfo)
-			variableType := method.VariableTypes[name]
-			if j < 1 {
-				vars[i][j] = fmt.Sprintf("\tMapping:\t%s %s -> :%s", name, variableType, variableInfo.Name)
-			} else {
-				vars[i][j] = fmt.Sprintf("\t\t\t%s %s -> :%s", name, variableType, variableInfo.Name)
-			}
-			j++
-		}
+	type Login winter.Controller
 
-		methodInfo[i] = fmt.Sprintf("%s",
-			strings.Join([]string{methodInfo[i], strings.Join(vars[i], "\n")}, "\n"))
+	//> fetch /customers
+	func (login *Login) GetCustomers() {
 	}
 
-	return fmt.Sprintf("Controller name: %s\n\n%s", name, strings.Join(methodInfo, "\n\n"))
+	//> GET /customers/:id
+	func (login *Login) GetCustomer(
+		id uint32, //> :id
+		token string, //> :
+	) {
+	}
+	`)
+	assert.IsType(t, ErrorList{}, err)
+	assert.Equal(t, "controller.go:6:6: Expected an Http Method before a path\n"+
+		"controller.go:13:22: Syntax error. Expected an identifier after ':'", err.Error())
 }
 
-func TestParseComments(t *testing.T) {
-	src := `
+func TestScanUnknownDirectives(t *testing.T) {
+	_, err := ScanFile("controller.go", `
 	package main
 
+	//> @maxbdy 1MB
 	type Login winter.Controller
-	type Salaag winter.Controller
 
-	//kkk
+	//> @body
 	//> GET /customers/:id
 	func (login *Login) GetCustomer(
 		id uint32, //> :id
-		token string, //> :token
-		coordinates string, //> :coordinates
-	) (response winter.Response, err winter.Error) {
-		return
+		token string, //> @strict
+	) {
 	}
+	`)
+	assert.Equal(t, "controller.go:4:6: Unknown directive @maxbdy\n"+
+		"controller.go:7:6: @body can only annotate a parameter\n"+
+		"controller.go:11:21: @strict cannot annotate a parameter", err.Error())
+}
 
-	//> GET /emails/:email
-	func (login *Login) GetEmail(
-		email string, //> :email
-	) (response winter.Response, err winter.Error) {
-		return
+func TestRegistryString(t *testing.T) {
+	gfr, _ := ScanFile("controller.go", controllerSource)
+	assert.Contains(t, gfr.String(), "Handler:\tLogin.GetEmail\n\t  Route:\tGET /emails/:email")
+	assert.Contains(t, gfr.String(), "Mapping:\tid uint32 -> :id")
+}
+
+func TestScanControllerAnnotations(t *testing.T) {
+	gfr, err := ScanFile("controller.go", `
+	package main
+
+	//> /customers/:customer
+	//> @use Audit
+	//> @produces application/json
+	type Customers winter.Controller
+
+	//> GET /orders/:id
+	//> @use RateLimit
+	//> @produces text/csv
+	func (c *Customers) GetOrder(
+		customer string, //> :customer
+		id string, //> :id
+	) {
 	}
-	`
-	fset := token.NewFileSet() // positions are relative to fset
-	f, err := parser.ParseFile(fset, "parser_test.go", src, parser.ParseComments)
-	if err != nil {
-		panic(err)
+
+	//> GET /
+	func (c *Customers) GetCustomer() {
 	}
+	`)
+	assert.NoError(t, err)
+	assert.Len(t, gfr.ControllerMethods, 2)
+
+	method := gfr.ControllerMethods[0]
+	assert.Equal(t, "/customers/:customer/orders/:id", method.Info.Info.(*RouteInfo).Path.String())
+	assert.Equal(t, "//> /customers/:customer", method.Prefix)
+	assert.Equal(t, "//> GET /orders/:id", method.Annotation)
+	assert.Equal(t, []*DirectiveInfo{
+		{"use", []string{"Audit"}},
+		{"use", []string{"RateLimit"}},
+		{"produces", []string{"text/csv"}},
+	}, method.Directives)
+
+	method = gfr.ControllerMethods[1]
+	assert.Equal(t, "/customers/:customer", method.Info.Info.(*RouteInfo).Path.String())
+	assert.Len(t, method.Directives, 2)
+}
+
+func TestScanControllerAnnotationErrors(t *testing.T) {
+	_, err := ScanFile("controller.go", `
+	package main
 
-	mdr := new(InterpreterMemory)
-	mdr.fset = ast.NewCommentMap(fset, f, f.Comments)
-	mdr.stored = new(GoFileRegistry)
+	//> /customers/:id
+	//> /clients
+	type Customers winter.Controller
 
-	//ast.Print(fset, f)
-	ast.Walk(VisitorFunc(mdr.Interpret), f)
+	//> GET /orders/:id
+	func (c *Customers) GetOrder() {
+	}
+	`)
+	assert.EqualError(t, err, "controller.go:5:2: A controller can only declare one route prefix\n"+
+		"controller.go:9:2: Customers.GetOrder: variable :id is already declared by the controller prefix /customers/:id")
+}
 
-	//fmt.Println(mdr.String())
+func TestScanIgnoresCommentsOfOtherTypes(t *testing.T) {
+	gfr, err := ScanFile("notes.go", `
+	package main
+
+	type Login winter.Controller
 
-	//assert.Fail(t, "none")
+	type Version struct{}
+
+	// > Note: compared as in //>= 3
+	//>= 3
+	func (version Version) AtLeast(
+		major int, //> ::major
+	) bool {
+		return true
+	}
+
+	//> GET /login
+	func (login *Login) Get() {
+	}
+	`)
+	assert.NoError(t, err)
+	assert.Len(t, gfr.ControllerMethods, 1)
+}
+
+func TestScanControllerDeclaredInAnotherFile(t *testing.T) {
+	fset := token.NewFileSet()
+	methods, err := parser.ParseFile(fset, "methods.go", `
+	package main
+
+	//> GET /login
+	func (login *Login) Get() {
+	}
+	`, parser.ParseComments)
+	assert.NoError(t, err)
+	types, err := parser.ParseFile(fset, "types.go", "package main\n\ntype Login winter.Controller\n", parser.ParseComments)
+	assert.NoError(t, err)
+
+	gfr, err := scan(fset, methods, types)
+	assert.NoError(t, err)
+	assert.Len(t, gfr.ControllerMethods, 1)
 }
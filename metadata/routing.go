@@ -25,6 +25,19 @@ type Get struct{}
 type Post struct{}
 type Put struct{}
 type Delete struct{}
+type Patch struct{}
+type Head struct{}
+type Options struct{}
+
+// Any matches every method a route is requested with.
+type Any struct{}
+
+// CustomMethod is any other method token, such as PROPFIND. It must be
+// written in upper case to be told apart from a path.
+type CustomMethod string
+
+// Methods is a route declared for several methods, as in GET|HEAD.
+type Methods []HttpMethod
 
 type IncompatibleMethod struct{}
 
@@ -38,8 +51,31 @@ func (pathList PathList) String() string {
 	return relativePath
 }
 
+// pattern renders the path with every variable collapsed to ':' so that
+// routes differing only in variable names compare equal.
+func (pathList PathList) pattern() string {
+	var relativePath string
+	for _, path := range pathList {
+		switch path := path.(type) {
+		case Entry:
+			relativePath += "/:"
+			if path.constraint != nil {
+				relativePath += path.constraint.String()
+			}
+			if path.Optional() {
+				relativePath += "?"
+			}
+		case CatchAll:
+			relativePath += "/*"
+		default:
+			relativePath += fmt.Sprintf("%c%v", '/', path)
+		}
+	}
+	return relativePath
+}
+
 func ToStringOfHttpMethod(method HttpMethod) string {
-	switch method.(type) {
+	switch method := method.(type) {
 	case Get:
 		return "GET"
 	case Post:
@@ -48,33 +84,100 @@ func ToStringOfHttpMethod(method HttpMethod) string {
 		return "PUT"
 	case Delete:
 		return "DELETE"
+	case Patch:
+		return "PATCH"
+	case Head:
+		return "HEAD"
+	case Options:
+		return "OPTIONS"
+	case Any:
+		return "ANY"
+	case CustomMethod:
+		return string(method)
+	case Methods:
+		return strings.Join(MethodNames(method), "|")
 	default:
 		return "UNDEFINED"
 	}
 }
 
+// MethodNames lists the methods of a route one by one.
+func MethodNames(method HttpMethod) []string {
+	methods, ok := method.(Methods)
+	if !ok {
+		return []string{ToStringOfHttpMethod(method)}
+	}
+	names := make([]string, len(methods))
+	for i, method := range methods {
+		names[i] = ToStringOfHttpMethod(method)
+	}
+	return names
+}
+
+// RouteInfo is a route as declared by its annotation. Query lists the
+// query arguments in order; Defaults and Required hold the ones declared
+// as :page=1 and :filter!.
 type RouteInfo struct {
-	Method  HttpMethod
-	Path    PathList
-	Mapping map[string]*interface{}
-	Query   []string
+	Method   HttpMethod
+	Path     PathList
+	Mapping  map[string]*interface{}
+	Query    []string
+	Defaults map[string]string
+	Required map[string]bool
 }
 
 type Entry struct {
-	key   string
-	value interface{}
+	key        string
+	value      interface{}
+	optional   bool
+	constraint *Constraint
 }
 
 func (entry Entry) String() string {
-	return fmt.Sprintf("%c%s", ':', entry.Text())
+	text := fmt.Sprintf("%c%s", ':', entry.Text())
+	if entry.constraint != nil {
+		text += entry.constraint.String()
+	}
+	if entry.optional {
+		text += "?"
+	}
+	return text
 }
 
 func (entry Entry) Text() string {
 	return entry.key
 }
 
+// Constraint returns the restriction on the values of the variable, if any.
+func (entry Entry) Constraint() *Constraint {
+	return entry.constraint
+}
+
+// Optional reports whether the route also matches without this segment.
+func (entry Entry) Optional() bool {
+	return entry.optional
+}
+
+// CatchAll is a variable that captures the rest of the path, slashes
+// included. It can only be the last segment of a path.
+type CatchAll struct {
+	Entry
+}
+
+func (catchAll CatchAll) String() string {
+	return fmt.Sprintf("%c%s", '*', catchAll.Text())
+}
+
 func NewRouteInfo(method HttpMethod) RouteInfo {
-	return RouteInfo{method, nil, nil, nil}
+	return RouteInfo{Method: method}
+}
+
+func (routeInfo *RouteInfo) AddMethod(method HttpMethod) {
+	methods, ok := routeInfo.Method.(Methods)
+	if !ok {
+		methods = Methods{routeInfo.Method}
+	}
+	routeInfo.Method = append(methods, method)
 }
 
 func (routeInfo *RouteInfo) ConcatenatePath(path string) {
@@ -85,11 +188,51 @@ func (routeInfo *RouteInfo) ConcatenatePathVariable(variable string) {
 	if routeInfo.Mapping == nil {
 		routeInfo.Mapping = make(map[string]*interface{}, 1)
 	}
-	entry := Entry{variable, nil}
+	entry := Entry{variable, nil, false, nil}
 	routeInfo.Path.add(entry)
 	routeInfo.Mapping[variable] = nil
 }
 
+func (routeInfo *RouteInfo) ConcatenateCatchAll(variable string) {
+	if routeInfo.Mapping == nil {
+		routeInfo.Mapping = make(map[string]*interface{}, 1)
+	}
+	routeInfo.Path.add(CatchAll{Entry{variable, nil, false, nil}})
+	routeInfo.Mapping[variable] = nil
+}
+
+// Constrain restricts the values of the last path variable. It reports
+// false when the path does not end with a variable.
+func (routeInfo *RouteInfo) Constrain(constraint *Constraint) bool {
+	last := len(routeInfo.Path) - 1
+	if last < 0 {
+		return false
+	}
+	entry, ok := routeInfo.Path[last].(Entry)
+	if !ok {
+		return false
+	}
+	entry.constraint = constraint
+	routeInfo.Path[last] = entry
+	return true
+}
+
+// MarkOptional makes the last path variable optional. It reports false when
+// the path does not end with a variable.
+func (routeInfo *RouteInfo) MarkOptional() bool {
+	last := len(routeInfo.Path) - 1
+	if last < 0 {
+		return false
+	}
+	entry, ok := routeInfo.Path[last].(Entry)
+	if !ok {
+		return false
+	}
+	entry.optional = true
+	routeInfo.Path[last] = entry
+	return true
+}
+
 func (routeInfo *RouteInfo) AddArgument(argument string) {
 	if routeInfo.Query == nil {
 		routeInfo.Query = []string{argument}
@@ -98,6 +241,41 @@ func (routeInfo *RouteInfo) AddArgument(argument string) {
 	}
 }
 
+// SetDefault gives the last query argument the value it takes when the
+// request does not carry it. It reports false when there is no argument or
+// it is already required or defaulted.
+func (routeInfo *RouteInfo) SetDefault(value string) bool {
+	last := len(routeInfo.Query) - 1
+	if last < 0 || routeInfo.Required[routeInfo.Query[last]] {
+		return false
+	}
+	if _, ok := routeInfo.Defaults[routeInfo.Query[last]]; ok {
+		return false
+	}
+	if routeInfo.Defaults == nil {
+		routeInfo.Defaults = make(map[string]string, 1)
+	}
+	routeInfo.Defaults[routeInfo.Query[last]] = value
+	return true
+}
+
+// Require makes the last query argument mandatory. It reports false when
+// there is no argument or it already has a default.
+func (routeInfo *RouteInfo) Require() bool {
+	last := len(routeInfo.Query) - 1
+	if last < 0 {
+		return false
+	}
+	if _, ok := routeInfo.Defaults[routeInfo.Query[last]]; ok {
+		return false
+	}
+	if routeInfo.Required == nil {
+		routeInfo.Required = make(map[string]bool, 1)
+	}
+	routeInfo.Required[routeInfo.Query[last]] = true
+	return true
+}
+
 func (pathList *PathList) add(object interface{}) {
 	*pathList = append(*pathList, object)
 }
@@ -112,7 +290,17 @@ func ToHttpMethod(method string) HttpMethod {
 		return Put{}
 	case "delete":
 		return Delete{}
-	default:
-		return IncompatibleMethod{}
+	case "patch":
+		return Patch{}
+	case "head":
+		return Head{}
+	case "options":
+		return Options{}
+	case "any":
+		return Any{}
+	}
+	if method != "" && strings.ToUpper(method) == method {
+		return CustomMethod(method)
 	}
+	return IncompatibleMethod{}
 }
@@ -0,0 +1,498 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metadata
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const winterImportPath = "github.com/rrborja/winter"
+
+type GoFileRegistry struct {
+	Controllers       []string
+	ControllerMethods []*ControllerMethodDescriptor
+}
+
+type ControllerMethodDescriptor struct {
+	Package        string
+	Controller     string
+	PointerMethod  bool
+	Name           string
+	Position       token.Position
+	Annotation     string
+	Prefix         string
+	Info           *Metadata
+	Directives     []*DirectiveInfo
+	Parameters     []string
+	ParameterTypes []string
+	Variables      map[string]*Metadata
+	VariableTypes  map[string]string
+	Results        []string
+	Imports        map[string]string
+}
+
+type InterpreterMemory struct {
+	fset        *token.FileSet
+	comments    ast.CommentMap
+	qualifier   string
+	imports     map[string]string
+	controllers map[string]*ControllerInfo
+	pending     []pendingMethod
+	methods     []*ControllerMethodDescriptor
+	errs        ErrorList
+}
+
+// pendingMethod is a method whose annotations are only read once its
+// receiver is known to be a controller, which may be declared in another
+// file of the package.
+type pendingMethod struct {
+	decl     *ast.FuncDecl
+	comments ast.CommentMap
+	imports  map[string]string
+}
+
+type VisitorFunc func(n ast.Node) ast.Visitor
+
+func (f VisitorFunc) Visit(n ast.Node) ast.Visitor { return f(n) }
+
+// ScanFile interprets the controller annotations of a single Go source file.
+// As with go/parser, src is read from filename when it is nil.
+func ScanFile(filename string, src interface{}) (*GoFileRegistry, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	return scan(fset, f)
+}
+
+// ScanPackage interprets the controller annotations of every non-test Go
+// source file in dir that satisfies the default build constraints.
+func ScanPackage(dir string) (*GoFileRegistry, error) {
+	return scanPackage(&build.Default, dir)
+}
+
+func scanPackage(ctx *build.Context, dir string) (*GoFileRegistry, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if match, err := ctx.MatchFile(dir, name); err != nil {
+			return nil, err
+		} else if !match {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+
+	return scan(fset, files...)
+}
+
+func scan(fset *token.FileSet, files ...*ast.File) (*GoFileRegistry, error) {
+	mdr := &InterpreterMemory{fset: fset, controllers: make(map[string]*ControllerInfo)}
+
+	for _, f := range files {
+		mdr.comments = ast.NewCommentMap(fset, f, f.Comments)
+		mdr.qualifier = qualifier(f)
+		mdr.imports = imports(f)
+		ast.Walk(VisitorFunc(mdr.Interpret), f)
+	}
+	for _, pending := range mdr.pending {
+		if _, ok := mdr.controllers[receiverName(pending.decl.Recv.List[0].Type)]; ok {
+			mdr.comments, mdr.imports = pending.comments, pending.imports
+			mdr.interpretMethod(pending.decl)
+		}
+	}
+
+	gfr := new(GoFileRegistry)
+	for name := range mdr.controllers {
+		gfr.Controllers = append(gfr.Controllers, name)
+	}
+	sort.Strings(gfr.Controllers)
+
+	for _, method := range mdr.methods {
+		controller, ok := mdr.controllers[method.Controller]
+		if !ok {
+			continue
+		}
+		if err := mdr.resolve(method, controller); err != nil {
+			mdr.errs = append(mdr.errs, &SyntaxError{
+				Filename: method.Position.Filename,
+				Line:     method.Position.Line,
+				Column:   method.Position.Column,
+				Message:  fmt.Sprintf("%s.%s: %v", method.Controller, method.Name, err),
+			})
+			continue
+		}
+		gfr.add(method)
+	}
+
+	if err := mdr.errs.err(); err != nil {
+		return nil, err
+	}
+	return gfr, nil
+}
+
+func qualifier(f *ast.File) string {
+	if f.Name.Name == "winter" {
+		return ""
+	}
+	for _, spec := range f.Imports {
+		if path, _ := strconv.Unquote(spec.Path.Value); path == winterImportPath {
+			if spec.Name != nil {
+				return spec.Name.Name
+			}
+			break
+		}
+	}
+	return "winter"
+}
+
+// imports maps the names under which f refers to its imports to their
+// paths, so that parameter types can be resolved outside of f.
+func imports(f *ast.File) map[string]string {
+	names := make(map[string]string, len(f.Imports))
+	for _, spec := range f.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		if spec.Name != nil {
+			names[spec.Name.Name] = path
+			continue
+		}
+		elements := strings.Split(path, "/")
+		name := elements[len(elements)-1]
+		if len(elements) > 1 && len(name) > 1 && name[0] == 'v' && strings.Trim(name[1:], "0123456789") == "" {
+			name = elements[len(elements)-2]
+		}
+		name = strings.TrimPrefix(name, "go-")
+		if i := strings.IndexByte(name, '.'); i > 0 {
+			name = name[:i]
+		}
+		names[name] = path
+	}
+	return names
+}
+
+func (gfr *GoFileRegistry) add(cmd *ControllerMethodDescriptor) {
+	gfr.ControllerMethods = append(gfr.ControllerMethods, cmd)
+}
+
+func (mdr *InterpreterMemory) Interpret(n ast.Node) ast.Visitor {
+	switch n := n.(type) {
+	case *ast.GenDecl:
+		if n.Tok != token.TYPE {
+			return nil
+		}
+		for _, spec := range n.Specs {
+			spec := spec.(*ast.TypeSpec)
+			if !mdr.isController(spec.Type) {
+				continue
+			}
+			// The doc comment of a lone type declaration belongs to the
+			// declaration rather than to its spec.
+			doc := spec.Doc
+			if doc == nil && !n.Lparen.IsValid() {
+				doc = n.Doc
+			}
+			mdr.controllers[spec.Name.Name] = mdr.interpretController(doc)
+		}
+		return nil
+	case *ast.FuncDecl:
+		if n.Recv != nil && n.Doc != nil {
+			mdr.pending = append(mdr.pending, pendingMethod{n, mdr.comments, mdr.imports})
+		}
+		return nil
+	}
+	return VisitorFunc(mdr.Interpret)
+}
+
+func (mdr *InterpreterMemory) isController(expr ast.Expr) bool {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		return mdr.qualifier == "" && expr.Name == "Controller"
+	case *ast.SelectorExpr:
+		pkg, ok := expr.X.(*ast.Ident)
+		return ok && pkg.Name == mdr.qualifier && expr.Sel.Name == "Controller"
+	case *ast.StructType:
+		for _, field := range expr.Fields.List {
+			if len(field.Names) == 0 && mdr.isController(field.Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// interpretController reads the prefix and the directives shared by the
+// routes of a controller.
+func (mdr *InterpreterMemory) interpretController(doc *ast.CommentGroup) *ControllerInfo {
+	controller := new(ControllerInfo)
+	if doc == nil {
+		return controller
+	}
+	for _, annotation := range mdr.annotations(doc) {
+		switch annotation.meta.Type {
+		case Prefix:
+			if controller.Prefix != nil {
+				mdr.failAt(annotation.comment, "A controller can only declare one route prefix")
+				continue
+			}
+			controller.Annotation = annotation.comment.Text
+			controller.Prefix = annotation.meta.Info.(*RouteInfo)
+		case Directive:
+			directive := annotation.meta.Info.(*DirectiveInfo)
+			if message := directive.misplaced(false); message != "" {
+				mdr.failAtDirective(annotation.comment, message)
+				continue
+			}
+			controller.Directives = append(controller.Directives, directive)
+		default:
+			mdr.failAt(annotation.comment, "Only a route prefix and directives can annotate a controller")
+		}
+	}
+	return controller
+}
+
+// resolve applies the prefix and the directives of the controller to the
+// route of the method.
+func (mdr *InterpreterMemory) resolve(method *ControllerMethodDescriptor, controller *ControllerInfo) error {
+	routeInfo, err := controller.Route(method.Info.Info.(*RouteInfo))
+	if err != nil {
+		return err
+	}
+	method.Info = &Metadata{Type: Route, Info: routeInfo}
+	method.Prefix = controller.Annotation
+	method.Directives = controller.Merge(method.Directives)
+	return nil
+}
+
+// interpretMethod records the method when its annotations are valid, and
+// every syntax error of them otherwise.
+func (mdr *InterpreterMemory) interpretMethod(n *ast.FuncDecl) {
+	var info *Metadata
+	var comment string
+	var directives []*DirectiveInfo
+	valid := true
+	for _, annotation := range mdr.annotations(n.Doc) {
+		switch annotation.meta.Type {
+		case Route:
+			if info != nil {
+				mdr.failAt(annotation.comment, "A method can only be annotated with one route")
+				valid = false
+				continue
+			}
+			info, comment = annotation.meta, annotation.comment.Text
+		case Directive:
+			directive := annotation.meta.Info.(*DirectiveInfo)
+			if message := directive.misplaced(false); message != "" {
+				mdr.failAtDirective(annotation.comment, message)
+				valid = false
+				continue
+			}
+			directives = append(directives, directive)
+		default:
+			mdr.failAt(annotation.comment, "Only a route and directives can annotate a method")
+			valid = false
+		}
+	}
+	if info == nil {
+		return
+	}
+
+	_, pointer := n.Recv.List[0].Type.(*ast.StarExpr)
+
+	method := &ControllerMethodDescriptor{
+		Controller:    receiverName(n.Recv.List[0].Type),
+		PointerMethod: pointer,
+		Name:          n.Name.Name,
+		Position:      mdr.fset.Position(n.Pos()),
+		Annotation:    comment,
+		Info:          info,
+		Directives:    directives,
+		Imports:       mdr.imports,
+		Variables:     make(map[string]*Metadata, n.Type.Params.NumFields()),
+		VariableTypes: make(map[string]string, n.Type.Params.NumFields()),
+	}
+
+	for _, f := range n.Type.Params.List {
+		var variable *Metadata
+		for _, group := range mdr.comments.Filter(f).Comments() {
+			meta, _, ok := mdr.annotation(group)
+			valid = valid && ok
+			if meta != nil {
+				variable = meta
+			}
+		}
+
+		typ := types.ExprString(f.Type)
+		if len(f.Names) == 0 {
+			method.Parameters = append(method.Parameters, "")
+			method.ParameterTypes = append(method.ParameterTypes, typ)
+			continue
+		}
+		for _, name := range f.Names {
+			method.Parameters = append(method.Parameters, name.Name)
+			method.ParameterTypes = append(method.ParameterTypes, typ)
+			if variable != nil {
+				method.Variables[name.Name] = variable
+				method.VariableTypes[name.Name] = typ
+			}
+		}
+	}
+
+	if n.Type.Results != nil {
+		for _, f := range n.Type.Results.List {
+			for i := 0; i < len(f.Names) || i == 0; i++ {
+				method.Results = append(method.Results, types.ExprString(f.Type))
+			}
+		}
+	}
+
+	if valid {
+		mdr.methods = append(mdr.methods, method)
+	}
+}
+
+type annotation struct {
+	meta    *Metadata
+	comment *ast.Comment
+}
+
+// annotations parses every annotation of the group. Syntax errors are
+// positioned in the source file and recorded.
+func (mdr *InterpreterMemory) annotations(group *ast.CommentGroup) []annotation {
+	var annotations []annotation
+	for _, comment := range group.List {
+		meta, err := ParseMetadata(comment.Text)
+		if err != nil {
+			mdr.record(comment, syntaxError(err))
+			continue
+		}
+		if meta != nil {
+			annotations = append(annotations, annotation{meta, comment})
+		}
+	}
+	return annotations
+}
+
+// syntaxError positions errors at the start of the annotation when the
+// parser could not tell where they are.
+func syntaxError(err error) *SyntaxError {
+	if syntaxError, ok := err.(*SyntaxError); ok {
+		return syntaxError
+	}
+	return &SyntaxError{Column: 1, Message: err.Error()}
+}
+
+func (mdr *InterpreterMemory) failAt(comment *ast.Comment, message string) {
+	mdr.record(comment, &SyntaxError{Column: 1, Message: message})
+}
+
+// failAtDirective positions the error at the '@' of the directive.
+func (mdr *InterpreterMemory) failAtDirective(comment *ast.Comment, message string) {
+	mdr.record(comment, &SyntaxError{Column: strings.IndexByte(comment.Text, '@') + 1, Message: message})
+}
+
+func (mdr *InterpreterMemory) record(comment *ast.Comment, syntaxError *SyntaxError) {
+	position := mdr.fset.Position(comment.Pos())
+	syntaxError.Filename = position.Filename
+	syntaxError.Line = position.Line
+	syntaxError.Column += position.Column - 1
+	mdr.errs = append(mdr.errs, syntaxError)
+}
+
+// annotation parses the first annotation of the group. Syntax errors are
+// positioned in the source file and recorded, and reported by ok.
+func (mdr *InterpreterMemory) annotation(group *ast.CommentGroup) (meta *Metadata, text string, ok bool) {
+	for _, comment := range group.List {
+		meta, err := ParseMetadata(comment.Text)
+		if err != nil {
+			mdr.record(comment, syntaxError(err))
+			return nil, "", false
+		}
+		if meta != nil && meta.Type == Directive {
+			if message := meta.Info.(*DirectiveInfo).misplaced(true); message != "" {
+				mdr.failAtDirective(comment, message)
+				return nil, "", false
+			}
+		}
+		if meta != nil {
+			return meta, comment.Text, true
+		}
+	}
+	return nil, "", true
+}
+
+func receiverName(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(expr.X)
+	case *ast.Ident:
+		return expr.Name
+	default:
+		return ""
+	}
+}
+
+func (gfr *GoFileRegistry) String() string {
+	methods := gfr.ControllerMethods
+
+	methodInfo := make([]string, len(methods))
+	for i, method := range methods {
+		routeInfo := method.Info.Info.(*RouteInfo)
+		methodInfo[i] = fmt.Sprintf("\tHandler:\t%s.%s\n\t  Route:\t%s %s",
+			method.Controller, method.Name, ToStringOfHttpMethod(routeInfo.Method), routeInfo.Path)
+
+		var vars []string
+		for _, name := range method.Parameters {
+			variable, ok := method.Variables[name]
+			if !ok || variable.Type != Variable {
+				continue
+			}
+			label := "\t\t\t"
+			if len(vars) == 0 {
+				label = "\tMapping:\t"
+			}
+			vars = append(vars, fmt.Sprintf("%s%s %s -> :%s",
+				label, name, method.VariableTypes[name], variable.Info.(*VariableInfo).Name))
+		}
+		if len(vars) > 0 {
+			methodInfo[i] += "\n" + strings.Join(vars, "\n")
+		}
+	}
+
+	return strings.Join(methodInfo, "\n\n")
+}
@@ -0,0 +1,121 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Crash is a panic recovered while serving a request, with the request it
+// happened on.
+type Crash struct {
+	Time       time.Time `json:"time"`
+	Panic      string    `json:"panic"`
+	Stack      string    `json:"stack"`
+	Method     string    `json:"method"`
+	URL        string    `json:"url"`
+	Route      string    `json:"route,omitempty"`
+	Handler    string    `json:"handler,omitempty"`
+	RemoteAddr string    `json:"remote_addr"`
+	RequestID  string    `json:"request_id,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+// Reporter is told about every panic a request recovered from, after the
+// request has been answered with an internal server error.
+type Reporter interface {
+	Report(crash *Crash)
+}
+
+// FileReporter appends every crash to a file as a line of JSON.
+type FileReporter struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+func NewFileReporter(path string) (*FileReporter, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileReporter{file: file}, nil
+}
+
+func (reporter *FileReporter) Report(crash *Crash) {
+	line, err := json.Marshal(crash)
+	if err != nil {
+		return
+	}
+	reporter.mutex.Lock()
+	defer reporter.mutex.Unlock()
+	reporter.file.Write(append(line, '\n'))
+}
+
+func (reporter *FileReporter) Close() error {
+	return reporter.file.Close()
+}
+
+// recover answers a request that panicked outside of the interceptors of
+// its route, which answer the panics of handlers themselves.
+func (table *routingTable) recover(response Response, req *http.Request, r *route) {
+	if value := recover(); value != nil {
+		if value == http.ErrAbortHandler {
+			panic(value)
+		}
+		table.crash(response, req, r, value)
+	}
+}
+
+// crash answers a request that panicked with an internal server error,
+// showing the stack in development, and reports the crash. A handler
+// aborting with http.ErrAbortHandler is left to net/http.
+func (table *routingTable) crash(response Response, req *http.Request, r *route, value interface{}) {
+	if value == http.ErrAbortHandler {
+		return
+	}
+
+	crash := &Crash{
+		Time:       time.Now().UTC(),
+		Panic:      fmt.Sprint(value),
+		Stack:      string(debug.Stack()),
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		Route:      r.String(),
+		Handler:    r.name,
+		RemoteAddr: req.RemoteAddr,
+		RequestID:  req.Header.Get("X-Request-Id"),
+		UserAgent:  req.UserAgent(),
+	}
+
+	if response.Written() == 0 {
+		rendered := problem(NewProblem(http.StatusInternalServerError, ""), req.URL.Path)
+		if table.development {
+			rendered.Detail = "panic: " + crash.Panic
+			rendered.Stack = strings.Split(strings.TrimSpace(crash.Stack), "\n")
+		}
+		writeProblem(response, rendered)
+	}
+
+	if table.reporter != nil {
+		table.reporter.Report(crash)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type crashes []*Crash
+
+func (list *crashes) Report(crash *Crash) {
+	*list = append(*list, crash)
+}
+
+func TestRecoverPanic(t *testing.T) {
+	var reported crashes
+	table := newTestRoutingTable(t)
+	table.reporter = &reported
+
+	req := httptest.NewRequest("GET", "/customers/7/crash", nil)
+	req.Header.Set("X-Request-Id", "r-7")
+	recorder := httptest.NewRecorder()
+	table.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	problem := decodeProblem(t, recorder)
+	assert.Empty(t, problem.Detail)
+	assert.Empty(t, problem.Stack)
+
+	assert.Len(t, reported, 1)
+	assert.Equal(t, "assignment to entry in nil map", reported[0].Panic)
+	assert.Equal(t, "GET /customers/:id/crash", reported[0].Route)
+	assert.Equal(t, "Customers.Crash", reported[0].Handler)
+	assert.Equal(t, "r-7", reported[0].RequestID)
+	assert.Contains(t, reported[0].Stack, "(*Customers).Crash")
+}
+
+func TestRecoverPanicInDevelopment(t *testing.T) {
+	table := newTestRoutingTable(t)
+	table.development = true
+
+	problem := decodeProblem(t, serve(table, "GET", "/customers/7/crash"))
+	assert.Equal(t, "panic: assignment to entry in nil map", problem.Detail)
+	assert.NotEmpty(t, problem.Stack)
+}
+
+func TestFileReporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crashes.jsonl")
+	reporter, err := NewFileReporter(path)
+	assert.NoError(t, err)
+
+	reporter.Report(&Crash{Panic: "first"})
+	reporter.Report(&Crash{Panic: "second"})
+	assert.NoError(t, reporter.Close())
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	lines := bytes.Split(bytes.TrimSpace(content), []byte("\n"))
+	assert.Len(t, lines, 2)
+
+	var crash Crash
+	assert.NoError(t, json.Unmarshal(lines[1], &crash))
+	assert.Equal(t, "second", crash.Panic)
+}
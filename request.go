@@ -1,5 +1,157 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
 package winter
 
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/rrborja/winter/metadata"
+)
+
+// Request is the request a route is serving, as injected into controller
+// methods that declare a parameter of this type. It does not share the
+// Arguments of the route, which are reused once the request has been
+// served, and so remains valid after the handler returns.
 type Request interface {
+	Method() string
+	URL() *url.URL
+
+	// Variable returns the named path variable and Variables all of them.
+	Variable(name string) string
+	Variables() Params
+
+	// Query includes the defaults of the query arguments of the route.
+	Query() url.Values
+	Header() http.Header
+	Cookie(name string) (*http.Cookie, error)
+	Cookies() []*http.Cookie
+	Body() io.ReadCloser
+	Context() context.Context
+	RemoteAddr() string
+	TLS() *tls.ConnectionState
+
+	// Route is the route the request matched.
+	Route() *metadata.RouteInfo
+
+	// Raw returns the underlying *http.Request.
+	Raw() *http.Request
+
 	Session() Session
 }
+
+type request struct {
+	req     *http.Request
+	route   *route
+	path    Params
+	query   url.Values
+	session Session
+}
+
+// Request returns the request the arguments were read from, copying the
+// path variables out of the arguments.
+func (arguments *Arguments) Request() Request {
+	r := &request{
+		req:   arguments.request,
+		route: arguments.route,
+		path:  append(Params(nil), arguments.Path...),
+		query: arguments.Query,
+	}
+	if arguments.session != nil {
+		r.session = arguments.session
+	}
+	return r
+}
+
+func (r *request) Method() string {
+	return r.req.Method
+}
+
+func (r *request) URL() *url.URL {
+	return r.req.URL
+}
+
+func (r *request) Variable(name string) string {
+	value, _ := r.path.Lookup(name)
+	return value
+}
+
+func (r *request) Variables() Params {
+	return append(Params(nil), r.path...)
+}
+
+// Query parses the query of the URL and fills in the defaults of the route
+// when the request was taken before the arguments were read.
+func (r *request) Query() url.Values {
+	if r.query == nil {
+		r.query = r.req.URL.Query()
+		if r.route != nil {
+			for name, value := range r.route.info.Defaults {
+				if _, ok := r.query[name]; !ok {
+					r.query[name] = []string{value}
+				}
+			}
+		}
+	}
+	return r.query
+}
+
+func (r *request) Header() http.Header {
+	return r.req.Header
+}
+
+func (r *request) Cookie(name string) (*http.Cookie, error) {
+	return r.req.Cookie(name)
+}
+
+func (r *request) Cookies() []*http.Cookie {
+	return r.req.Cookies()
+}
+
+func (r *request) Body() io.ReadCloser {
+	return r.req.Body
+}
+
+func (r *request) Context() context.Context {
+	return r.req.Context()
+}
+
+func (r *request) RemoteAddr() string {
+	return r.req.RemoteAddr
+}
+
+func (r *request) TLS() *tls.ConnectionState {
+	return r.req.TLS
+}
+
+func (r *request) Route() *metadata.RouteInfo {
+	if r.route == nil {
+		return nil
+	}
+	return r.route.info
+}
+
+func (r *request) Raw() *http.Request {
+	return r.req
+}
+
+// Session returns the session of the request, nil unless the server was
+// configured with one.
+func (r *request) Session() Session {
+	return r.session
+}
@@ -1,8 +1,184 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
 package winter
 
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// Response is the response of a route, as injected into controller methods
+// that declare a parameter of this type or built with NewResponse and
+// returned by them. The status is only written with the first byte of the
+// body, so headers and cookies can be set until then.
 type Response interface {
+	Header() http.Header
 	Write([]byte) (int, error)
+	WriteHeader(status int)
+
+	SetCookie(cookie *http.Cookie)
+
+	// Redirect sets the Location header and a 3xx status. Found and
+	// SeeOther are the usual redirects after a GET and a POST.
+	Redirect(location string, status int)
+	Found(location string)
+	SeeOther(location string)
+
+	// Flush writes the status, headers and buffered body to the client.
+	Flush()
+	// Hijack hands the connection over to the caller, as http.Hijacker.
+	Hijack() (net.Conn, *bufio.ReadWriter, error)
+
+	// Status is the status written or about to be written, and Written the
+	// number of bytes of the body written so far.
+	Status() int
+	Written() int64
 }
 
 type ResponseFormat interface {
 }
+
+// Error is the error a handler returns alongside its Response.
+type Error interface {
+	error
+}
+
+var errDetached = errors.New("winter: response is not attached to a connection")
+
+type response struct {
+	writer    http.ResponseWriter
+	header    http.Header
+	body      bytes.Buffer
+	status    int
+	written   int64
+	committed bool
+}
+
+// NewResponse returns a response for a handler to build and return instead
+// of writing to the one of the request. It is written once the handler
+// returns.
+func NewResponse() Response {
+	return &response{header: make(http.Header)}
+}
+
+func newResponse(w http.ResponseWriter) *response {
+	return &response{writer: w, header: w.Header()}
+}
+
+func (r *response) Header() http.Header {
+	return r.header
+}
+
+func (r *response) Write(b []byte) (int, error) {
+	if r.writer == nil {
+		n, err := r.body.Write(b)
+		r.written += int64(n)
+		return n, err
+	}
+	r.commit()
+	n, err := r.writer.Write(b)
+	r.written += int64(n)
+	return n, err
+}
+
+// WriteHeader records the status, which is ignored once the body has
+// started to be written.
+func (r *response) WriteHeader(status int) {
+	if !r.committed {
+		r.status = status
+	}
+}
+
+func (r *response) SetCookie(cookie *http.Cookie) {
+	if v := cookie.String(); v != "" {
+		r.header.Add("Set-Cookie", v)
+	}
+}
+
+func (r *response) Redirect(location string, status int) {
+	r.header.Set("Location", location)
+	r.WriteHeader(status)
+}
+
+func (r *response) Found(location string) {
+	r.Redirect(location, http.StatusFound)
+}
+
+func (r *response) SeeOther(location string) {
+	r.Redirect(location, http.StatusSeeOther)
+}
+
+func (r *response) Flush() {
+	if r.writer == nil {
+		return
+	}
+	r.commit()
+	if flusher, ok := r.writer.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *response) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if r.writer == nil {
+		return nil, nil, errDetached
+	}
+	hijacker, ok := r.writer.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		r.committed = true
+	}
+	return conn, rw, err
+}
+
+func (r *response) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+func (r *response) Written() int64 {
+	return r.written
+}
+
+// Unwrap returns the writer of the request, for http.ResponseController.
+func (r *response) Unwrap() http.ResponseWriter {
+	return r.writer
+}
+
+func (r *response) commit() {
+	if !r.committed {
+		r.committed = true
+		r.writer.WriteHeader(r.Status())
+	}
+}
+
+// send writes a response built with NewResponse as the response of the
+// request.
+func (r *response) send(built Response) {
+	for key, values := range built.Header() {
+		r.header[key] = values
+	}
+	r.WriteHeader(built.Status())
+	if built, ok := built.(*response); ok {
+		r.Write(built.body.Bytes())
+	}
+}
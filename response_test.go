@@ -0,0 +1,61 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseDefersStatus(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	response := newResponse(recorder)
+
+	response.WriteHeader(http.StatusAccepted)
+	response.Header().Set("X-Late", "yes")
+	assert.Equal(t, http.StatusAccepted, response.Status())
+	assert.False(t, recorder.Flushed)
+
+	response.Write([]byte("queued"))
+	response.WriteHeader(http.StatusTeapot)
+	response.Flush()
+
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.Equal(t, "yes", recorder.Header().Get("X-Late"))
+	assert.True(t, recorder.Flushed)
+	assert.Equal(t, http.StatusAccepted, response.Status())
+	assert.Equal(t, int64(6), response.Written())
+}
+
+func TestResponseRedirect(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	response := newResponse(recorder)
+	response.SeeOther("/customers/7")
+	response.commit()
+
+	assert.Equal(t, http.StatusSeeOther, recorder.Code)
+	assert.Equal(t, "/customers/7", recorder.Header().Get("Location"))
+}
+
+func TestResponseHijackUnsupported(t *testing.T) {
+	_, _, err := newResponse(httptest.NewRecorder()).Hijack()
+	assert.Equal(t, http.ErrNotSupported, err)
+
+	_, _, err = NewResponse().Hijack()
+	assert.Equal(t, errDetached, err)
+}
@@ -0,0 +1,436 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+
+	"github.com/rrborja/winter/metadata"
+)
+
+var (
+	responseType = reflect.TypeOf((*Response)(nil)).Elem()
+	requestType  = reflect.TypeOf((*Request)(nil)).Elem()
+)
+
+// Arguments holds the path variables and query arguments of a matched route.
+// Query is only parsed for routes that declare query arguments.
+type Arguments struct {
+	Path  Params
+	Query url.Values
+
+	request *http.Request
+	route   *route
+	source  string
+	headers *Arguments
+	cookies *Arguments
+	session *Handler
+}
+
+// Get returns the path variable of the given name, falling back to the
+// query argument when the route declares no such variable.
+func (arguments *Arguments) Get(name string) string {
+	if value, ok := arguments.Path.Lookup(name); ok {
+		return value
+	}
+	return arguments.Query.Get(name)
+}
+
+// MissingArgumentError reports a query argument declared as required, as
+// in :filter!, that the request does not carry.
+type MissingArgumentError struct {
+	Variable string
+}
+
+func (err *MissingArgumentError) Error() string {
+	return fmt.Sprintf("missing required query argument :%s", err.Variable)
+}
+
+func (err *MissingArgumentError) Status() int {
+	return http.StatusBadRequest
+}
+
+// query parses the query arguments of routes that declare them, filling
+// in the defaults of the ones the request does not carry.
+func (arguments *Arguments) query(info *metadata.RouteInfo, u *url.URL) error {
+	if len(info.Query) == 0 {
+		return nil
+	}
+	arguments.Query = u.Query()
+	for _, name := range info.Query {
+		if _, ok := arguments.Query[name]; ok {
+			continue
+		}
+		if value, ok := info.Defaults[name]; ok {
+			arguments.Query[name] = []string{value}
+		} else if info.Required[name] {
+			return &MissingArgumentError{name}
+		}
+	}
+	return nil
+}
+
+// Invoker calls a controller method with the arguments of a matched route
+// and returns whatever the method returned. A non-nil error means the
+// arguments could not be converted to the method's parameters.
+type Invoker func(controller Controller, response Response, arguments *Arguments) ([]interface{}, error)
+
+type binding struct {
+	variable string
+	source   string
+	inject   bool
+	request  bool
+	body     bool
+	typ      reflect.Type
+	convert  conversion
+}
+
+type route struct {
+	name         string
+	info         *metadata.RouteInfo
+	interceptors chain
+	directives   []*metadata.DirectiveInfo
+	body         bodyOptions
+	guard        guard
+	variables    []string
+	controller   Controller
+	invoke       Invoker
+}
+
+func (r *route) String() string {
+	return metadata.ToStringOfHttpMethod(r.info.Method) + " " + r.info.Path.String()
+}
+
+type controllerSet map[string][]reflect.Value
+
+func newControllerSet(controllers []Controller) controllerSet {
+	set := make(controllerSet, len(controllers))
+	for _, controller := range controllers {
+		value := reflect.ValueOf(controller)
+		name := reflect.Indirect(value).Type().Name()
+		set[name] = append(set[name], value)
+	}
+	return set
+}
+
+// lookup tells controllers of the same name apart when the source was
+// loaded with a module path. Commands are always in package main.
+func (set controllerSet) lookup(name, pkg string) (reflect.Value, bool) {
+	for _, controller := range set[name] {
+		pkgPath := reflect.Indirect(controller).Type().PkgPath()
+		if pkg == "" || pkgPath == "main" || pkgPath == pkg {
+			return controller, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func newRoutingTable(registry *metadata.GoFileRegistry, controllers []Controller) (*routingTable, error) {
+	table := newRouter()
+	set := newControllerSet(controllers)
+
+	for _, method := range registry.ControllerMethods {
+		controller, ok := set.lookup(method.Controller, method.Package)
+		if !ok {
+			continue
+		}
+
+		handler := controller.MethodByName(method.Name)
+		if !handler.IsValid() {
+			return nil, fmt.Errorf("%s.%s is annotated as a route but is not an exported method of %s",
+				method.Controller, method.Name, controller.Type())
+		}
+
+		info := method.Info.Info.(*metadata.RouteInfo)
+
+		handlerType := handler.Type()
+		if handlerType.NumIn() != len(method.Parameters) {
+			return nil, fmt.Errorf("%s.%s: parameter list does not match its source", method.Controller, method.Name)
+		}
+
+		var bindings []binding
+		for i, name := range method.Parameters {
+			parameterType := handlerType.In(i)
+			variable, annotated := method.Variables[name]
+
+			switch {
+			case parameterType == responseType:
+				bindings = append(bindings, binding{inject: true, typ: parameterType})
+			case parameterType == requestType:
+				bindings = append(bindings, binding{request: true, typ: parameterType})
+			case !annotated:
+				return nil, fmt.Errorf("%s.%s: parameter %s has no annotation", method.Controller, method.Name, name)
+			case variable.Type == metadata.Directive:
+				directive := variable.Info.(*metadata.DirectiveInfo)
+				switch directive.Name {
+				case "body":
+					bindings = append(bindings, binding{body: true, typ: parameterType})
+					continue
+				case headerSource, cookieSource, remoteSource:
+				default:
+					return nil, fmt.Errorf("%s.%s: parameter %s cannot be annotated with @%s",
+						method.Controller, method.Name, name, directive.Name)
+				}
+				convert, err := converter(parameterType)
+				if err != nil {
+					return nil, fmt.Errorf("%s.%s: parameter %s: %v", method.Controller, method.Name, name, err)
+				}
+				bindings = append(bindings, binding{
+					variable: sourceName(directive.Name, name, directive.Arguments),
+					source:   directive.Name,
+					typ:      parameterType,
+					convert:  convert,
+				})
+			case variable.Type != metadata.Variable:
+				return nil, fmt.Errorf("%s.%s: parameter %s must be bound to a single variable", method.Controller, method.Name, name)
+			default:
+				variableName := variable.Info.(*metadata.VariableInfo).Name
+				if _, ok := info.Mapping[variableName]; !ok && !contains(info.Query, variableName) {
+					return nil, fmt.Errorf("%s.%s: parameter %s refers to undeclared variable :%s",
+						method.Controller, method.Name, name, variableName)
+				}
+				convert, err := converter(parameterType)
+				if err != nil {
+					return nil, fmt.Errorf("%s.%s: parameter %s: %v", method.Controller, method.Name, name, err)
+				}
+				bindings = append(bindings, binding{variable: variableName, typ: parameterType, convert: convert})
+			}
+		}
+
+		body, err := newBodyOptions(method.Directives)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", method.Position, err)
+		}
+		guard, err := newGuard(method.Directives)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", method.Position, err)
+		}
+
+		err = table.add(&route{
+			name:       method.Controller + "." + method.Name,
+			info:       info,
+			directives: method.Directives,
+			body:       body,
+			guard:      guard,
+			controller: controller.Interface(),
+			invoke:     reflectInvoker(handler, bindings),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", method.Position, err)
+		}
+	}
+
+	return table, nil
+}
+
+func reflectInvoker(handler reflect.Value, bindings []binding) Invoker {
+	return func(_ Controller, response Response, arguments *Arguments) ([]interface{}, error) {
+		values := make([]reflect.Value, len(bindings))
+		for i, b := range bindings {
+			if b.inject {
+				values[i] = reflect.ValueOf(response).Convert(b.typ)
+				continue
+			}
+			if b.request {
+				values[i] = reflect.ValueOf(arguments.Request())
+				continue
+			}
+			if b.body {
+				value, err := decodeBody(arguments, b.typ)
+				if err != nil {
+					return nil, err
+				}
+				values[i] = value
+				continue
+			}
+			value, err := b.convert(arguments.from(b.source), b.variable)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+
+		results := handler.Call(values)
+		interfaces := make([]interface{}, len(results))
+		for i, result := range results {
+			interfaces[i] = result.Interface()
+		}
+		return interfaces, nil
+	}
+}
+
+func (table *routingTable) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	arguments := table.arguments.Get().(*Arguments)
+	defer func() {
+		arguments.Path = arguments.Path[:0]
+		arguments.Query = nil
+		arguments.request = nil
+		arguments.route = nil
+		arguments.headers = nil
+		arguments.cookies = nil
+		arguments.session = nil
+		table.arguments.Put(arguments)
+	}()
+
+	r := table.lookup(req.Method, req.URL.Path, &arguments.Path)
+	if r == nil && req.Method == http.MethodHead {
+		if r = table.lookup(http.MethodGet, req.URL.Path, &arguments.Path); r != nil {
+			w = headResponse{w}
+		}
+	}
+	if r == nil && req.Method == http.MethodOptions {
+		if allow := table.allowed(req.URL.Path, &arguments.Path); allow != "" {
+			w.Header().Set("Allow", allow)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	if r == nil {
+		writeProblem(w, problem(NotFound(""), req.URL.Path))
+		return
+	}
+	arguments.request = req
+	arguments.route = r
+
+	response := newResponse(w)
+	defer response.commit()
+	defer table.recover(response, req, r)
+	if table.session != nil {
+		arguments.session = table.session.bind(req, response)
+	}
+
+	var built Response
+	r.interceptors.serve(arguments.Request(), response, func() error {
+		if err := r.guard.check(req, response, arguments.session); err != nil {
+			return err
+		}
+		if err := arguments.query(r.info, req.URL); err != nil {
+			return err
+		}
+		results, err := r.invoke(r.controller, response, arguments)
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			switch result := result.(type) {
+			case error:
+				return result
+			case Response:
+				if result != Response(response) {
+					built = result
+				}
+			}
+		}
+		return nil
+	}, func(err error) {
+		// A handler returning the response it built with NewResponse has
+		// it written only once the request succeeded.
+		switch err := err.(type) {
+		case nil:
+			if built != nil {
+				response.send(built)
+			}
+		case *PanicError:
+			table.crash(response, req, r, err.Value)
+		default:
+			table.fail(response, req, err)
+		}
+	})
+}
+
+// fail answers with the Exception the error resolves to, rendered as a
+// problem. A response whose body has started to be written is left as it
+// is. Internal errors only show their message in development.
+func (table *routingTable) fail(response Response, req *http.Request, err error) {
+	if response.Written() > 0 {
+		return
+	}
+	rendered := problem(exception(table.exceptions, err), req.URL.Path)
+	if table.development && rendered.Code >= http.StatusInternalServerError && rendered.Err != nil {
+		rendered.Detail = rendered.Err.Error()
+	}
+	writeProblem(response, rendered)
+}
+
+// intercept wraps every route with the interceptors of the context,
+// followed by the ones the route declares with @use.
+func (table *routingTable) intercept(context *Context) error {
+	if context == nil {
+		context = new(Context)
+	}
+	for _, r := range table.routes {
+		r.interceptors = append(chain(nil), context.interceptors...)
+		used := make(map[string]bool)
+		for _, directive := range r.directives {
+			if directive.Name != "use" {
+				continue
+			}
+			for _, name := range directive.Arguments {
+				interceptor, ok := context.named[name]
+				if !ok {
+					return fmt.Errorf("%s: no interceptor is registered as %s", r.name, name)
+				}
+				if !used[name] {
+					used[name] = true
+					r.interceptors = append(r.interceptors, interceptor)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// headResponse serves a HEAD request with the GET route of the same path,
+// keeping the headers and dropping the body.
+type headResponse struct {
+	http.ResponseWriter
+}
+
+func (response headResponse) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (response headResponse) Flush() {
+	if flusher, ok := response.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (response headResponse) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := response.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the writer of the GET route, for http.ResponseController.
+func (response headResponse) Unwrap() http.ResponseWriter {
+	return response.ResponseWriter
+}
+
+func contains(list []string, value string) bool {
+	for _, element := range list {
+		if element == value {
+			return true
+		}
+	}
+	return false
+}
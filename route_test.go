@@ -0,0 +1,453 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rrborja/winter/metadata"
+	"github.com/stretchr/testify/assert"
+)
+
+type Customers struct {
+	Controller
+}
+
+// > GET /customers/:id
+func (customers *Customers) GetCustomer(
+	id string, //> :id
+	response Response,
+) error {
+	_, err := response.Write([]byte("customer " + id))
+	return err
+}
+
+// > GET /customers/:id/orders ? :status
+func (customers *Customers) GetOrders(
+	id string, //> :id
+	status string, //> :status
+	response Response,
+) error {
+	_, err := response.Write([]byte(id + " orders " + status))
+	return err
+}
+
+// > GET|HEAD /customers/:id/avatar
+func (customers *Customers) GetAvatar(
+	id string, //> :id
+	response Response,
+) error {
+	_, err := response.Write([]byte("avatar " + id))
+	return err
+}
+
+// > ANY /customers/:id/events
+func (customers *Customers) Events(
+	id string, //> :id
+	response Response,
+) error {
+	_, err := response.Write([]byte("events " + id))
+	return err
+}
+
+// > DELETE /customers/:id
+func (customers *Customers) DeleteCustomer(
+	id string, //> :id
+) error {
+	return fmt.Errorf("customer %s is %w", id, errLocked)
+}
+
+// > GET /customers/:number/invoices ? :since :within :limit
+func (customers *Customers) GetInvoices(
+	number uint32, //> :number
+	since time.Time, //> :since
+	within time.Duration, //> :within
+	limit *int, //> :limit
+	response Response,
+) error {
+	_, err := fmt.Fprintf(response, "%d %s %s %v", number, since.Format("2006-01-02"), within, limit != nil)
+	return err
+}
+
+type address struct {
+	Street string `json:"street" xml:"street"`
+	City   string `json:"city" xml:"city" form:"city"`
+}
+
+// > PUT /customers/:id/address
+// > @strict
+// > @maxbody 64B
+func (customers *Customers) PutAddress(
+	id string, //> :id
+	address *address, //> @body
+	response Response,
+) error {
+	if address == nil {
+		_, err := response.Write([]byte("no address for " + id))
+		return err
+	}
+	_, err := fmt.Fprintf(response, "%s lives on %s in %s", id, address.Street, address.City)
+	return err
+}
+
+// > GET /customers/:id/visits
+func (customers *Customers) GetVisits(
+	id string, //> :id
+	requestId string, //> @header X-Request-Id
+	page *uint8, //> @header x-page
+	session string, //> @cookie session
+	client net.IP, //> @remote
+	response Response,
+) error {
+	_, err := fmt.Fprintf(response, "%s %s %v %s %s", id, requestId, page != nil, session, client)
+	return err
+}
+
+// > GET /customers/:id/payments ? :page=1 :method :currency!
+func (customers *Customers) GetPayments(
+	id string, //> :id
+	page int, //> :page
+	methods []string, //> :method
+	currency string, //> :currency
+	response Response,
+) error {
+	_, err := fmt.Fprintf(response, "%s %d %v %s", id, page, methods, currency)
+	return err
+}
+
+// > GET /customers/:id/request ? :page=1
+func (customers *Customers) GetRequest(
+	request Request,
+	response Response,
+) error {
+	_, err := fmt.Fprintf(response, "%s %s %s %v %s %s %s", request.Method(), request.URL().Path,
+		request.Variable("id"), request.Query()["page"], request.Header().Get("Accept"),
+		request.Route().Path, request.RemoteAddr())
+	return err
+}
+
+// > POST /customers/:id/notes
+// > @use Audit
+func (customers *Customers) PostNote(
+	id string, //> :id
+) (Response, Error) {
+	response := NewResponse()
+	response.Header().Set("Location", "/customers/"+id+"/notes/1")
+	response.SetCookie(&http.Cookie{Name: "last-note", Value: "1"})
+	response.WriteHeader(http.StatusCreated)
+	_, err := response.Write([]byte("note 1"))
+	return response, err
+}
+
+// > GET /customers/:id/crash
+func (customers *Customers) Crash(
+	id string, //> :id
+) {
+	var orders map[string]int
+	orders[id]++
+}
+
+// > /suppliers/:supplier
+type Suppliers struct {
+	Controller
+}
+
+// > GET /products/:id
+func (suppliers *Suppliers) GetProduct(
+	supplier string, //> :supplier
+	id string, //> :id
+	response Response,
+) error {
+	_, err := response.Write([]byte(supplier + " product " + id))
+	return err
+}
+
+func newTestRoutingTable(t *testing.T) *routingTable {
+	registry, err := metadata.ScanFile("route_test.go", nil)
+	assert.NoError(t, err)
+
+	table, err := newRoutingTable(registry, []Controller{new(Customers)})
+	assert.NoError(t, err)
+
+	return table
+}
+
+func serve(handler http.Handler, method, target string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+	return recorder
+}
+
+func decodeProblem(t *testing.T, recorder *httptest.ResponseRecorder) *Problem {
+	assert.Equal(t, "application/problem+json", recorder.Header().Get("Content-Type"))
+	problem := new(Problem)
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), problem))
+	return problem
+}
+
+func send(handler http.Handler, method, target, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestDispatchPathVariable(t *testing.T) {
+	recorder := serve(newTestRoutingTable(t), "GET", "/customers/42")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "customer 42", recorder.Body.String())
+}
+
+func TestDispatchQueryArgument(t *testing.T) {
+	recorder := serve(newTestRoutingTable(t), "GET", "/customers/42/orders?status=open")
+	assert.Equal(t, "42 orders open", recorder.Body.String())
+}
+
+func TestDispatchUnknownRoute(t *testing.T) {
+	recorder := serve(newTestRoutingTable(t), "POST", "/customers/42")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Equal(t, "/customers/42", decodeProblem(t, recorder).Instance)
+
+	recorder = serve(testRouter(t, "> GET /orders/:id<int>"), "GET", "/orders/latest")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Equal(t, "Not Found", decodeProblem(t, recorder).Title)
+}
+
+func TestDispatchHandlerError(t *testing.T) {
+	recorder := serve(newTestRoutingTable(t), "DELETE", "/customers/42")
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.NotContains(t, recorder.Body.String(), "locked")
+	assert.Equal(t, "Internal Server Error", decodeProblem(t, recorder).Detail)
+
+	table := newTestRoutingTable(t)
+	table.development = true
+	recorder = serve(table, "DELETE", "/customers/42")
+	assert.Equal(t, "customer 42 is locked", decodeProblem(t, recorder).Detail)
+}
+
+func TestDispatchTypedParameters(t *testing.T) {
+	recorder := serve(newTestRoutingTable(t), "GET", "/customers/7/invoices?since=2017-05-01T00:00:00Z&within=90m")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "7 2017-05-01 1h30m0s false", recorder.Body.String())
+}
+
+func TestDispatchConversionFailure(t *testing.T) {
+	recorder := serve(newTestRoutingTable(t), "GET", "/customers/seven/invoices")
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, decodeProblem(t, recorder).Detail, `invalid value "seven" for :number: expected uint32`)
+}
+
+func TestDispatchMultipleMethods(t *testing.T) {
+	table := newTestRoutingTable(t)
+	assert.Equal(t, "avatar 7", serve(table, "GET", "/customers/7/avatar").Body.String())
+	assert.Equal(t, http.StatusOK, serve(table, "HEAD", "/customers/7/avatar").Code)
+}
+
+func TestDispatchAnyMethod(t *testing.T) {
+	table := newTestRoutingTable(t)
+	for _, method := range []string{"GET", "POST", "PATCH", "OPTIONS", "PROPFIND"} {
+		assert.Equal(t, "events 7", serve(table, method, "/customers/7/events").Body.String(), method)
+	}
+}
+
+func TestDispatchAutomaticHead(t *testing.T) {
+	recorder := serve(newTestRoutingTable(t), "HEAD", "/customers/42")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, recorder.Body.String())
+}
+
+func TestHeadResponsePassesThrough(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	var w http.ResponseWriter = headResponse{recorder}
+
+	w.(http.Flusher).Flush()
+	assert.True(t, recorder.Flushed)
+
+	_, _, err := w.(http.Hijacker).Hijack()
+	assert.Equal(t, http.ErrNotSupported, err)
+
+	assert.Equal(t, recorder, w.(interface{ Unwrap() http.ResponseWriter }).Unwrap())
+}
+
+func TestDispatchAutomaticOptions(t *testing.T) {
+	recorder := serve(newTestRoutingTable(t), "OPTIONS", "/customers/42")
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, "DELETE, GET, HEAD, OPTIONS", recorder.Header().Get("Allow"))
+
+	recorder = serve(newTestRoutingTable(t), "OPTIONS", "/suppliers/42")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Equal(t, "/suppliers/42", decodeProblem(t, recorder).Instance)
+}
+
+func TestDispatchControllerPrefix(t *testing.T) {
+	registry, err := metadata.ScanFile("route_test.go", nil)
+	assert.NoError(t, err)
+	table, err := newRoutingTable(registry, []Controller{new(Suppliers)})
+	assert.NoError(t, err)
+
+	recorder := serve(table, "GET", "/suppliers/acme/products/7")
+	assert.Equal(t, "acme product 7", recorder.Body.String())
+}
+
+func TestCompiledControllerPrefix(t *testing.T) {
+	table, err := newCompiledRoutingTable([]CompiledRoute{{
+		Controller: "Suppliers",
+		Method:     "GetProduct",
+		Prefix:     "//> /suppliers/:supplier",
+		Annotation: "//> GET /products/:id",
+		Directives: []string{"//> @use Audit"},
+		Invoke: func(controller Controller, response Response, arguments *Arguments) ([]interface{}, error) {
+			err := controller.(*Suppliers).GetProduct(arguments.Get("supplier"), arguments.Get("id"), response)
+			return []interface{}{err}, nil
+		},
+	}}, []Controller{new(Suppliers)})
+	assert.NoError(t, err)
+
+	recorder := serve(table, "GET", "/suppliers/acme/products/7")
+	assert.Equal(t, "acme product 7", recorder.Body.String())
+
+	_, err = newCompiledRoutingTable([]CompiledRoute{{
+		Controller: "Suppliers",
+		Method:     "GetProduct",
+		Annotation: "//> GET /products/:id",
+	}}, []Controller{Suppliers{}})
+	assert.EqualError(t, err, "Suppliers.GetProduct is annotated as a route but is not an exported method of winter.Suppliers")
+}
+
+func TestDispatchBody(t *testing.T) {
+	table := newTestRoutingTable(t)
+
+	recorder := send(table, "PUT", "/customers/7/address", "application/json", `{"street":"Elm","city":"Oslo"}`)
+	assert.Equal(t, "7 lives on Elm in Oslo", recorder.Body.String())
+
+	recorder = send(table, "PUT", "/customers/7/address", "application/xml", `<address><street>Elm</street><city>Oslo</city></address>`)
+	assert.Equal(t, "7 lives on Elm in Oslo", recorder.Body.String())
+
+	recorder = send(table, "PUT", "/customers/7/address", "application/x-www-form-urlencoded", "street=Elm&city=Oslo")
+	assert.Equal(t, "7 lives on Elm in Oslo", recorder.Body.String())
+
+	assert.Equal(t, "no address for 7", serve(table, "PUT", "/customers/7/address").Body.String())
+}
+
+func TestDispatchBodyErrors(t *testing.T) {
+	table := newTestRoutingTable(t)
+
+	recorder := send(table, "PUT", "/customers/7/address", "application/json", `{"street":`)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = send(table, "PUT", "/customers/7/address", "application/json", `{"zip":"0150"}`)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, decodeProblem(t, recorder).Detail, `unknown field "zip"`)
+
+	recorder = send(table, "PUT", "/customers/7/address", "text/plain", "Elm")
+	assert.Equal(t, http.StatusUnsupportedMediaType, recorder.Code)
+
+	recorder = send(table, "PUT", "/customers/7/address", "application/json", `{"street":"`+strings.Repeat("x", 64)+`"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+}
+
+func TestDispatchRequestParameters(t *testing.T) {
+	table := newTestRoutingTable(t)
+
+	req := httptest.NewRequest("GET", "/customers/7/visits", nil)
+	req.Header.Set("X-Request-Id", "r-1")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "s-1"})
+	req.RemoteAddr = "10.0.0.1:5123"
+	recorder := httptest.NewRecorder()
+	table.ServeHTTP(recorder, req)
+	assert.Equal(t, "7 r-1 false s-1 10.0.0.1", recorder.Body.String())
+
+	req.Header.Set("X-Page", "many")
+	recorder = httptest.NewRecorder()
+	table.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, decodeProblem(t, recorder).Detail, `invalid value "many" for header X-Page: expected uint8`)
+}
+
+func TestDispatchQueryDefaultsAndRequired(t *testing.T) {
+	table := newTestRoutingTable(t)
+
+	recorder := serve(table, "GET", "/customers/7/payments?currency=EUR&method=card&method=cash")
+	assert.Equal(t, "7 1 [card cash] EUR", recorder.Body.String())
+
+	recorder = serve(table, "GET", "/customers/7/payments?page=3")
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, decodeProblem(t, recorder).Detail, "missing required query argument :currency")
+}
+
+func TestDispatchRequest(t *testing.T) {
+	req := httptest.NewRequest("GET", "/customers/7/request", nil)
+	req.Header.Set("Accept", "text/plain")
+	recorder := httptest.NewRecorder()
+	newTestRoutingTable(t).ServeHTTP(recorder, req)
+	assert.Equal(t, "GET /customers/7/request 7 [1] text/plain /customers/:id/request 192.0.2.1:1234", recorder.Body.String())
+}
+
+type retainingInterceptor struct {
+	requests chan Request
+}
+
+func (i retainingInterceptor) Before(request Request, response Response) bool {
+	i.requests <- request
+	return true
+}
+
+func (retainingInterceptor) After(Response, Request) Exception { return nil }
+func (retainingInterceptor) Done(Response, Request, error)     {}
+
+// TestDispatchRequestOutlivesHandler reads requests kept past their
+// handler while the table serves others, and is meant for go test -race.
+func TestDispatchRequestOutlivesHandler(t *testing.T) {
+	interceptor := retainingInterceptor{make(chan Request, 64)}
+	context := new(Context)
+	context.Use(interceptor)
+	context.Register("Audit", interceptor)
+	table := newTestRoutingTable(t)
+	assert.NoError(t, table.intercept(context))
+
+	var wait sync.WaitGroup
+	for i := 0; i < 64; i++ {
+		wait.Add(1)
+		go func(id string) {
+			defer wait.Done()
+			serve(table, "GET", "/customers/"+id+"/request?page=2")
+		}(fmt.Sprint(i))
+	}
+	for i := 0; i < 64; i++ {
+		request := <-interceptor.requests
+		id := strings.Split(request.URL().Path, "/")[2]
+		assert.Equal(t, id, request.Variable("id"))
+		assert.Equal(t, "2", request.Query().Get("page"))
+		assert.Equal(t, "/customers/:id/request", request.Route().Path.String())
+	}
+	wait.Wait()
+}
+
+func TestDispatchReturnedResponse(t *testing.T) {
+	recorder := serve(newTestRoutingTable(t), "POST", "/customers/7/notes")
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	assert.Equal(t, "/customers/7/notes/1", recorder.Header().Get("Location"))
+	assert.Equal(t, "last-note=1", recorder.Header().Get("Set-Cookie"))
+	assert.Equal(t, "note 1", recorder.Body.String())
+}
@@ -0,0 +1,351 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rrborja/winter/metadata"
+)
+
+// Param is a path variable captured while matching a route.
+type Param struct {
+	Key   string
+	Value string
+}
+
+type Params []Param
+
+func (params Params) Lookup(name string) (string, bool) {
+	for _, param := range params {
+		if param.Key == name {
+			return param.Value, true
+		}
+	}
+	return "", false
+}
+
+// node is an edge of a compressed radix tree. Literal children are indexed
+// by the first byte of their prefix; variable children match one whole
+// path segment, constrained ones first, and a catch-all child the rest of
+// the path. The names of the variables belong to the route, so routes
+// sharing a prefix may name their variables differently.
+type node struct {
+	prefix     string
+	indices    string
+	children   []*node
+	variables  []*node
+	constraint *metadata.Constraint
+	catchAll   *node
+	route      *route
+}
+
+type routingTable struct {
+	trees       map[string]*node
+	routes      []*route
+	exceptions  []exceptionMapping
+	reporter    Reporter
+	development bool
+	session     *Handler
+	methods     []string
+	maxParams   int
+	arguments   sync.Pool
+}
+
+func newRouter() *routingTable {
+	table := &routingTable{trees: make(map[string]*node)}
+	table.arguments.New = func() interface{} {
+		return &Arguments{Path: make(Params, 0, table.maxParams)}
+	}
+	return table
+}
+
+func (table *routingTable) add(r *route) error {
+	table.routes = append(table.routes, r)
+
+	r.variables = r.variables[:0]
+	for _, element := range r.info.Path {
+		switch element := element.(type) {
+		case metadata.Entry:
+			r.variables = append(r.variables, element.Text())
+		case metadata.CatchAll:
+			r.variables = append(r.variables, element.Text())
+		}
+	}
+	if len(r.variables) > table.maxParams {
+		table.maxParams = len(r.variables)
+	}
+
+	// A path ending with optional segments is inserted once for each of
+	// them, from the shortest to the full path.
+	shortest := len(r.info.Path)
+	for shortest > 0 {
+		entry, ok := r.info.Path[shortest-1].(metadata.Entry)
+		if !ok || !entry.Optional() {
+			break
+		}
+		shortest--
+	}
+
+	for _, method := range metadata.MethodNames(r.info.Method) {
+		for length := shortest; length <= len(r.info.Path); length++ {
+			if err := table.insert(method, r.info.Path[:length], r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (table *routingTable) insert(method string, path metadata.PathList, r *route) error {
+	root, ok := table.trees[method]
+	if !ok {
+		root = new(node)
+		table.trees[method] = root
+		table.methods = append(table.methods, method)
+		sort.Strings(table.methods)
+	}
+
+	n := root
+	for _, element := range path {
+		n = n.literal("/")
+		switch element := element.(type) {
+		case string:
+			n = n.literal(element)
+		case metadata.Entry:
+			n = n.variable(element.Constraint())
+		case metadata.CatchAll:
+			if n.catchAll == nil {
+				n.catchAll = new(node)
+			}
+			n = n.catchAll
+		}
+	}
+	if len(path) == 0 {
+		n = n.literal("/")
+	}
+
+	if n.route != nil {
+		return fmt.Errorf("route %s %s conflicts with %s %s", method, r.info.Path, method, n.route.info.Path)
+	}
+	n.route = r
+	return nil
+}
+
+// literal walks s down the tree, splitting edges where s diverges from
+// them, and returns the node at which s ends.
+func (n *node) literal(s string) *node {
+	for s != "" {
+		i := strings.IndexByte(n.indices, s[0])
+		if i < 0 {
+			child := &node{prefix: s}
+			n.indices += s[:1]
+			n.children = append(n.children, child)
+			return child
+		}
+
+		child := n.children[i]
+		common := 0
+		for common < len(s) && common < len(child.prefix) && s[common] == child.prefix[common] {
+			common++
+		}
+
+		if common < len(child.prefix) {
+			split := &node{
+				prefix:     child.prefix[common:],
+				indices:    child.indices,
+				children:   child.children,
+				variables:  child.variables,
+				constraint: child.constraint,
+				catchAll:   child.catchAll,
+				route:      child.route,
+			}
+			*child = node{
+				prefix:     child.prefix[:common],
+				indices:    split.prefix[:1],
+				children:   []*node{split},
+				constraint: child.constraint,
+			}
+		}
+
+		s = s[common:]
+		n = child
+	}
+	return n
+}
+
+// variable returns the variable child with the given constraint, adding it
+// ahead of the unconstrained child when there is none yet.
+func (n *node) variable(constraint *metadata.Constraint) *node {
+	for _, child := range n.variables {
+		if child.constraint == nil && constraint == nil ||
+			child.constraint != nil && constraint != nil && child.constraint.Name == constraint.Name {
+			return child
+		}
+	}
+
+	child := &node{constraint: constraint}
+	if constraint != nil && len(n.variables) > 0 && n.variables[len(n.variables)-1].constraint == nil {
+		last := len(n.variables) - 1
+		n.variables = append(n.variables[:last], child, n.variables[last])
+	} else {
+		n.variables = append(n.variables, child)
+	}
+	return child
+}
+
+// lookup finds the route of the request path and appends its variables to
+// params. Routes declared for ANY are tried after the ones declared for the
+// method itself. It does not allocate as long as params has room for the
+// variables.
+func (table *routingTable) lookup(method, path string, params *Params) *route {
+	start := len(*params)
+	trimmed := trimTrailingSlash(path)
+	r := table.find(method, trimmed, params)
+
+	// A catch-all keeps the trailing slash, and matches the empty rest of
+	// a path such as /static/.
+	if trimmed != path && (r == nil || r.catchesAll()) {
+		*params = (*params)[:start]
+		if r = table.find(method, path, params); r != nil && !r.catchesAll() {
+			*params = (*params)[:start]
+			r = nil
+		}
+	}
+	if r != nil {
+		for i := range *params {
+			(*params)[i].Key = r.variables[i]
+		}
+	}
+	return r
+}
+
+func (table *routingTable) find(method, path string, params *Params) *route {
+	if r := table.match(method, path, params); r != nil {
+		return r
+	}
+	return table.match("ANY", path, params)
+}
+
+func (table *routingTable) match(method, path string, params *Params) *route {
+	root, ok := table.trees[method]
+	if !ok {
+		return nil
+	}
+	return root.match(path, params)
+}
+
+// allowed lists the methods the path can be requested with, counting the
+// HEAD and OPTIONS requests that are answered on behalf of the routes. It
+// returns an empty string when no route has the path.
+func (table *routingTable) allowed(path string, params *Params) string {
+	var methods []string
+	for _, method := range table.methods {
+		if method == "ANY" {
+			continue
+		}
+		*params = (*params)[:0]
+		if table.match(method, trimTrailingSlash(path), params) != nil {
+			methods = append(methods, method)
+			continue
+		}
+		*params = (*params)[:0]
+		if r := table.match(method, path, params); r != nil && r.catchesAll() {
+			methods = append(methods, method)
+		}
+	}
+	*params = (*params)[:0]
+
+	if len(methods) == 0 {
+		return ""
+	}
+	if contains(methods, http.MethodGet) && !contains(methods, http.MethodHead) {
+		methods = append(methods, http.MethodHead)
+	}
+	if !contains(methods, http.MethodOptions) {
+		methods = append(methods, http.MethodOptions)
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+// catchesAll tells whether the path of the route ends with a catch-all.
+func (r *route) catchesAll() bool {
+	path := r.info.Path
+	if len(path) == 0 {
+		return false
+	}
+	_, ok := path[len(path)-1].(metadata.CatchAll)
+	return ok
+}
+
+func trimTrailingSlash(path string) string {
+	if len(path) > 1 && path[len(path)-1] == '/' {
+		return path[:len(path)-1]
+	}
+	return path
+}
+
+// match prefers literal edges, then variables, then catch-alls, and
+// backtracks when the rest of the path cannot be matched below an edge.
+func (n *node) match(path string, params *Params) *route {
+	if path == "" {
+		if n.route == nil && n.catchAll != nil && n.catchAll.route != nil {
+			*params = append(*params, Param{})
+			return n.catchAll.route
+		}
+		return n.route
+	}
+
+	if i := strings.IndexByte(n.indices, path[0]); i >= 0 {
+		child := n.children[i]
+		if strings.HasPrefix(path, child.prefix) {
+			if r := child.match(path[len(child.prefix):], params); r != nil {
+				return r
+			}
+		}
+	}
+
+	if len(n.variables) > 0 {
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		if end > 0 {
+			segment := path[:end]
+			for _, child := range n.variables {
+				if child.constraint != nil && !child.constraint.Match(segment) {
+					continue
+				}
+				*params = append(*params, Param{Value: segment})
+				if r := child.match(path[end:], params); r != nil {
+					return r
+				}
+				*params = (*params)[:len(*params)-1]
+			}
+		}
+	}
+
+	if n.catchAll != nil && n.catchAll.route != nil {
+		*params = append(*params, Param{Value: path})
+		return n.catchAll.route
+	}
+
+	return nil
+}
@@ -0,0 +1,220 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"testing"
+
+	"github.com/rrborja/winter/metadata"
+	"github.com/stretchr/testify/assert"
+)
+
+func testRouter(t testing.TB, annotations ...string) *routingTable {
+	table := newRouter()
+	for _, annotation := range annotations {
+		meta, err := metadata.ParseMetadata(annotation)
+		assert.NoError(t, err)
+		assert.NoError(t, table.add(&route{info: meta.Info.(*metadata.RouteInfo), controller: annotation}))
+	}
+	return table
+}
+
+func lookup(table *routingTable, method, path string) (string, Params) {
+	params := make(Params, 0, table.maxParams)
+	r := table.lookup(method, path, &params)
+	if r == nil {
+		return "", nil
+	}
+	return r.controller.(string), params
+}
+
+func TestRouterLiteralBeforeVariable(t *testing.T) {
+	table := testRouter(t,
+		"> GET /customers/:id",
+		"> GET /customers/new",
+		"> GET /customers/:id/orders",
+		"> GET /customers/newest/orders",
+	)
+
+	matched, params := lookup(table, "GET", "/customers/new")
+	assert.Equal(t, "> GET /customers/new", matched)
+	assert.Empty(t, params)
+
+	matched, params = lookup(table, "GET", "/customers/42")
+	assert.Equal(t, "> GET /customers/:id", matched)
+	assert.Equal(t, Params{{"id", "42"}}, params)
+
+	matched, params = lookup(table, "GET", "/customers/new/orders")
+	assert.Equal(t, "> GET /customers/:id/orders", matched)
+	assert.Equal(t, Params{{"id", "new"}}, params)
+
+	matched, _ = lookup(table, "GET", "/customers/newest/orders/")
+	assert.Equal(t, "> GET /customers/newest/orders", matched)
+}
+
+func TestRouterVariableNamesPerRoute(t *testing.T) {
+	table := testRouter(t,
+		"> GET /customers/:id/orders",
+		"> GET /customers/:name/emails/:email",
+	)
+
+	_, params := lookup(table, "GET", "/customers/ann/emails/ann@example.com")
+	assert.Equal(t, Params{{"name", "ann"}, {"email", "ann@example.com"}}, params)
+
+	_, params = lookup(table, "GET", "/customers/7/orders")
+	assert.Equal(t, Params{{"id", "7"}}, params)
+}
+
+func TestRouterNoMatch(t *testing.T) {
+	table := testRouter(t, "> GET /customers/:id", "> POST /customers")
+
+	for _, request := range [][2]string{
+		{"GET", "/customers"},
+		{"GET", "/customers/7/orders"},
+		{"PUT", "/customers/7"},
+		{"GET", "/customers//"},
+	} {
+		matched, _ := lookup(table, request[0], request[1])
+		assert.Empty(t, matched, "%s %s", request[0], request[1])
+	}
+}
+
+func TestRouterAmbiguousRoutes(t *testing.T) {
+	table := testRouter(t, "> GET /customer/:id")
+
+	meta, _ := metadata.ParseMetadata("> GET /customer/:name")
+	err := table.add(&route{info: meta.Info.(*metadata.RouteInfo)})
+	assert.EqualError(t, err, "route GET /customer/:name conflicts with GET /customer/:id")
+}
+
+func TestRouterDoesNotAllocate(t *testing.T) {
+	table := testRouter(t,
+		"> GET /customers/:id",
+		"> GET /customers/:id/orders/:order",
+		"> GET /emails/:email",
+	)
+	params := make(Params, 0, table.maxParams)
+
+	allocations := testing.AllocsPerRun(100, func() {
+		params = params[:0]
+		table.lookup("GET", "/customers/42/orders/7", &params)
+	})
+	assert.Zero(t, allocations)
+}
+
+func BenchmarkRouter(b *testing.B) {
+	table := testRouter(b,
+		"> GET /customers/:id",
+		"> GET /customers/:id/orders/:order",
+		"> GET /emails/:email",
+	)
+	params := make(Params, 0, table.maxParams)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		params = params[:0]
+		table.lookup("GET", "/customers/42/orders/7", &params)
+	}
+}
+
+func TestRouterCatchAll(t *testing.T) {
+	table := testRouter(t,
+		"> GET /static/*filepath",
+		"> GET /static/favicon",
+		"> GET /static/:name/info",
+	)
+
+	matched, params := lookup(table, "GET", "/static/css/site/main.css")
+	assert.Equal(t, "> GET /static/*filepath", matched)
+	assert.Equal(t, Params{{"filepath", "css/site/main.css"}}, params)
+
+	matched, _ = lookup(table, "GET", "/static/favicon")
+	assert.Equal(t, "> GET /static/favicon", matched)
+
+	matched, params = lookup(table, "GET", "/static/logo/info")
+	assert.Equal(t, "> GET /static/:name/info", matched)
+	assert.Equal(t, Params{{"name", "logo"}}, params)
+
+	matched, params = lookup(table, "GET", "/static/logo/raw")
+	assert.Equal(t, "> GET /static/*filepath", matched)
+	assert.Equal(t, Params{{"filepath", "logo/raw"}}, params)
+
+	matched, _ = lookup(table, "GET", "/static")
+	assert.Empty(t, matched)
+
+	matched, params = lookup(table, "GET", "/static/")
+	assert.Equal(t, "> GET /static/*filepath", matched)
+	assert.Equal(t, Params{{"filepath", ""}}, params)
+
+	matched, params = lookup(table, "GET", "/static/a/b/")
+	assert.Equal(t, "> GET /static/*filepath", matched)
+	assert.Equal(t, Params{{"filepath", "a/b/"}}, params)
+
+	matched, _ = lookup(table, "GET", "/static/favicon/")
+	assert.Equal(t, "> GET /static/favicon", matched)
+
+	matched, params = lookup(table, "GET", "/static/logo/info/")
+	assert.Equal(t, "> GET /static/:name/info", matched)
+	assert.Equal(t, Params{{"name", "logo"}}, params)
+}
+
+func TestRouterOptionalSegments(t *testing.T) {
+	table := testRouter(t, "> GET /reports/:year/:month?/:day?")
+
+	_, params := lookup(table, "GET", "/reports/2017")
+	assert.Equal(t, Params{{"year", "2017"}}, params)
+
+	_, params = lookup(table, "GET", "/reports/2017/05")
+	assert.Equal(t, Params{{"year", "2017"}, {"month", "05"}}, params)
+
+	_, params = lookup(table, "GET", "/reports/2017/05/01")
+	assert.Equal(t, Params{{"year", "2017"}, {"month", "05"}, {"day", "01"}}, params)
+
+	meta, _ := metadata.ParseMetadata("> GET /reports/:year")
+	assert.Error(t, table.add(&route{info: meta.Info.(*metadata.RouteInfo)}))
+}
+
+func TestRouterConstraints(t *testing.T) {
+	table := testRouter(t,
+		"> GET /orders/:slug",
+		"> GET /orders/:id<int>",
+		"> GET /orders/:day<date>/summary",
+		"> GET /users/:slug<[a-z0-9-]+>",
+	)
+
+	matched, params := lookup(table, "GET", "/orders/42")
+	assert.Equal(t, "> GET /orders/:id<int>", matched)
+	assert.Equal(t, Params{{"id", "42"}}, params)
+
+	matched, params = lookup(table, "GET", "/orders/latest")
+	assert.Equal(t, "> GET /orders/:slug", matched)
+	assert.Equal(t, Params{{"slug", "latest"}}, params)
+
+	matched, _ = lookup(table, "GET", "/orders/2017-05-01/summary")
+	assert.Equal(t, "> GET /orders/:day<date>/summary", matched)
+
+	matched, _ = lookup(table, "GET", "/orders/yesterday/summary")
+	assert.Empty(t, matched)
+
+	matched, _ = lookup(table, "GET", "/users/Winter_Is_Coming")
+	assert.Empty(t, matched)
+}
+
+func TestRouterConstrainedRoutesDoNotConflict(t *testing.T) {
+	table := testRouter(t, "> GET /orders/:id<int>", "> GET /orders/:code<alpha>")
+
+	meta, _ := metadata.ParseMetadata("> GET /orders/:number<int>")
+	assert.Error(t, table.add(&route{info: meta.Info.(*metadata.RouteInfo)}))
+}
@@ -1,19 +1,66 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
 package winter
 
 import (
-	"crypto/rsa"
-	"github.com/dgrijalva/jwt-go"
+	"fmt"
+	"net/http"
 	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
 )
 
+// DefaultSessionHeader carries the tokens a Handler issues when it has
+// neither a ResponseHeader nor a Cookie.
+const DefaultSessionHeader = "X-Session-Token"
+
+// Handler issues the tokens of a session, signed with the key registered
+// for their issuer and subject in Keys, or else in the Security of the
+// Store. A token is sent back in Cookie when it is set, and otherwise in
+// the ResponseHeader, X-Session-Token by default. Requests present it as a
+// bearer token in Header, Authorization by default, or in Cookie, and Query
+// names the query parameter it can also be read from.
+//
+// Tokens are issued for Audience and only accepted from Issuer and for
+// Audience when those are set. Skew is the clock difference tolerated when
+// checking their times.
 type Handler struct {
 	token *string
 	Store
+
+	Keys           KeyStore
+	Algorithm      string
+	Header         string
+	ResponseHeader string
+	Cookie         string
+	Query          string
+
+	Issuer   string
+	Audience string
+	Skew     time.Duration
+
+	request        *http.Request
+	response       Response
+	authentication *Authentication
 }
 
 type Session interface {
 	New(payload Manifest, password ...string) error
 	Authenticate() bool
+	Authentication() *Authentication
 }
 
 type Manifest interface {
@@ -22,24 +69,106 @@ type Manifest interface {
 	Expiry() int64
 }
 
-func key(handler *Handler, issuer string, subject string) *rsa.PrivateKey {
+func key(handler *Handler, issuer string, subject string) (string, interface{}) {
 	uniqueId := strings.Join([]string{issuer, subject}, ":")
-	return handler.Key[uniqueId]
-	//handler.Key[issuer:subject]
+	return handler.keys().SigningKey(uniqueId)
 }
 
-func (handler *Handler) New(payload Manifest, password ...string) {
+// keys returns the KeyStore of the handler, its Security unless Keys is
+// set.
+func (handler *Handler) keys() KeyStore {
+	if handler.Keys != nil {
+		return handler.Keys
+	}
+	return handler.Security
+}
+
+// bind returns a copy of the handler serving a single request.
+func (handler *Handler) bind(request *http.Request, response Response) *Handler {
+	bound := *handler
+	bound.token = nil
+	bound.request = request
+	bound.response = response
+	bound.authentication = nil
+	return &bound
+}
+
+// New signs a token for the payload and sends it with the response of the
+// request the handler serves. The algorithm follows
+// from the type of the key unless the handler declares one the key signs
+// with. The password is not used.
+func (handler *Handler) New(payload Manifest, password ...string) error {
 	issuer := payload.Issuer()
 	subject := payload.Subject()
 	claims := &jwt.StandardClaims{
 		ExpiresAt: payload.Expiry(),
+		IssuedAt:  time.Now().Unix(),
 		Issuer:    issuer,
 		Subject:   subject,
+		Audience:  handler.Audience,
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	privateKey := key(handler, issuer, subject)
-	signedToken, _ := token.SignedString(*privateKey)
+	id, signingKey := key(handler, issuer, subject)
+	if signingKey == nil {
+		return fmt.Errorf("winter: no key for %s:%s", issuer, subject)
+	}
+
+	algorithm, accepted := algorithms(signingKey)
+	if accepted == nil {
+		return fmt.Errorf("winter: unsupported key type %T for %s:%s", signingKey, issuer, subject)
+	}
+	if handler.Algorithm != "" {
+		algorithm = handler.Algorithm
+	}
+	method, ok := accepted[algorithm]
+	if !ok {
+		return fmt.Errorf("winter: unsupported signing algorithm %s", algorithm)
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	if id != "" {
+		token.Header["kid"] = id
+	}
+	signedToken, err := token.SignedString(signingKey)
+	if err != nil {
+		return err
+	}
 
 	handler.token = &signedToken
+	handler.send(signedToken, payload.Expiry())
+	return nil
+}
+
+// Token returns the token issued by New, if any.
+func (handler *Handler) Token() string {
+	if handler.token == nil {
+		return ""
+	}
+	return *handler.token
+}
+
+func (handler *Handler) send(token string, expiry int64) {
+	if handler.response == nil {
+		return
+	}
+	if handler.Cookie != "" {
+		cookie := &http.Cookie{
+			Name:     handler.Cookie,
+			Value:    token,
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   handler.request != nil && handler.request.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		}
+		if expiry > 0 {
+			cookie.Expires = time.Unix(expiry, 0)
+		}
+		handler.response.SetCookie(cookie)
+		return
+	}
+	header := handler.ResponseHeader
+	if header == "" {
+		header = DefaultSessionHeader
+	}
+	handler.response.Header().Set(header, token)
 }
@@ -1 +1,324 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
 package winter
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type manifest struct {
+	issuer, subject string
+	expiry          int64
+}
+
+func (m manifest) Issuer() string  { return m.issuer }
+func (m manifest) Subject() string { return m.subject }
+func (m manifest) Expiry() int64   { return m.expiry }
+
+var _ Session = (*Handler)(nil)
+
+func testHandler(t *testing.T) (*Handler, *rsa.PrivateKey) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	store := Store{Security{Key: map[string]crypto.Signer{"winter:ann": privateKey}}}
+	return &Handler{Store: store}, privateKey
+}
+
+func TestSessionSignsWithRSA(t *testing.T) {
+	handler, privateKey := testHandler(t)
+	expiry := time.Now().Add(time.Hour).Unix()
+
+	for _, algorithm := range []string{"", "RS256", "RS384", "RS512", "PS256", "PS512"} {
+		handler.Algorithm = algorithm
+		assert.NoError(t, handler.New(manifest{"winter", "ann", expiry}))
+
+		claims := new(jwt.StandardClaims)
+		token, err := jwt.ParseWithClaims(handler.Token(), claims, func(token *jwt.Token) (interface{}, error) {
+			return &privateKey.PublicKey, nil
+		})
+		assert.NoError(t, err)
+		assert.True(t, token.Valid)
+		if algorithm == "" {
+			algorithm = DefaultAlgorithm
+		}
+		assert.Equal(t, algorithm, token.Method.Alg())
+		assert.Equal(t, "winter", claims.Issuer)
+		assert.Equal(t, "ann", claims.Subject)
+		assert.Equal(t, expiry, claims.ExpiresAt)
+	}
+}
+
+func TestSessionErrors(t *testing.T) {
+	handler, _ := testHandler(t)
+
+	handler.Algorithm = "HS256"
+	assert.EqualError(t, handler.New(manifest{"winter", "ann", 0}), "winter: unsupported signing algorithm HS256")
+
+	handler.Algorithm = ""
+	assert.EqualError(t, handler.New(manifest{"winter", "bob", 0}), "winter: no key for winter:bob")
+	assert.Empty(t, handler.Token())
+}
+
+func TestSessionSendsToken(t *testing.T) {
+	handler, _ := testHandler(t)
+	expiry := time.Now().Add(time.Hour).Unix()
+
+	recorder := httptest.NewRecorder()
+	response := newResponse(recorder)
+	bound := handler.bind(httptest.NewRequest("POST", "/login", nil), response)
+	assert.NoError(t, bound.New(manifest{"winter", "ann", expiry}))
+	response.commit()
+	assert.Equal(t, bound.Token(), recorder.Header().Get("X-Session-Token"))
+	assert.Empty(t, recorder.Header().Get("Authorization"))
+	assert.Empty(t, handler.Token())
+
+	handler.ResponseHeader = "X-Token"
+	recorder = httptest.NewRecorder()
+	response = newResponse(recorder)
+	bound = handler.bind(httptest.NewRequest("POST", "/login", nil), response)
+	assert.NoError(t, bound.New(manifest{"winter", "ann", expiry}))
+	response.commit()
+	assert.Equal(t, bound.Token(), recorder.Header().Get("X-Token"))
+
+	handler.Cookie = "session"
+	recorder = httptest.NewRecorder()
+	response = newResponse(recorder)
+	bound = handler.bind(httptest.NewRequest("POST", "https://example.com/login", nil), response)
+	assert.NoError(t, bound.New(manifest{"winter", "ann", expiry}))
+	response.commit()
+
+	cookie := recorder.Result().Cookies()[0]
+	assert.Equal(t, "session", cookie.Name)
+	assert.Equal(t, bound.Token(), cookie.Value)
+	assert.True(t, cookie.HttpOnly)
+	assert.True(t, cookie.Secure)
+	assert.Equal(t, expiry, cookie.Expires.Unix())
+	assert.Empty(t, recorder.Header().Get("X-Token"))
+	assert.Equal(t, 2, strings.Count(cookie.Value, "."))
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, claims *jwt.StandardClaims) string {
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	assert.NoError(t, err)
+	return token
+}
+
+func authenticate(handler *Handler, req *http.Request) *Authentication {
+	bound := handler.bind(req, newResponse(httptest.NewRecorder()))
+	bound.Authenticate()
+	return bound.Authentication()
+}
+
+func TestSessionAuthenticates(t *testing.T) {
+	handler, _ := testHandler(t)
+	handler.Cookie = "session"
+	handler.Query = "token"
+	assert.NoError(t, handler.New(manifest{"winter", "ann", time.Now().Add(time.Hour).Unix()}))
+	token := handler.Token()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "bearer "+token)
+	authentication := authenticate(handler, req)
+	assert.True(t, authentication.Valid())
+	assert.Equal(t, "header", authentication.Source)
+	assert.Equal(t, "ann", authentication.Claims.Subject)
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: token})
+	assert.Equal(t, "cookie", authenticate(handler, req).Source)
+
+	req = httptest.NewRequest("GET", "/?token="+token, nil)
+	assert.Equal(t, "query", authenticate(handler, req).Source)
+
+	authentication = authenticate(handler, httptest.NewRequest("GET", "/", nil))
+	assert.False(t, authentication.Valid())
+	assert.Equal(t, ErrNoToken, authentication.Err)
+	assert.Equal(t, http.StatusUnauthorized, authentication.Status())
+
+	assert.False(t, handler.Authenticate())
+}
+
+func TestSessionRejects(t *testing.T) {
+	handler, privateKey := testHandler(t)
+	handler.Issuer = "winter"
+	handler.Audience = "shop"
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	now := time.Now().Unix()
+	valid := func() *jwt.StandardClaims {
+		return &jwt.StandardClaims{Issuer: "winter", Subject: "ann", Audience: "shop", IssuedAt: now, ExpiresAt: now + 60}
+	}
+	expired, early, future, stranger, unknown, elsewhere := valid(), valid(), valid(), valid(), valid(), valid()
+	expired.ExpiresAt = now - 60
+	early.NotBefore = now + 60
+	future.IssuedAt = now + 60
+	stranger.Audience = "bank"
+	unknown.Subject = "bob"
+	elsewhere.Issuer = "spring"
+
+	for _, test := range []struct {
+		token    string
+		expected error
+	}{
+		{sign(t, jwt.SigningMethodRS256, privateKey, valid()), nil},
+		{sign(t, jwt.SigningMethodRS256, privateKey, expired), ErrExpired},
+		{sign(t, jwt.SigningMethodRS256, privateKey, early), ErrNotYetValid},
+		{sign(t, jwt.SigningMethodRS256, privateKey, future), ErrIssuedInFuture},
+		{sign(t, jwt.SigningMethodRS256, privateKey, stranger), ErrAudience},
+		{sign(t, jwt.SigningMethodRS256, privateKey, unknown), ErrUnknownKey},
+		{sign(t, jwt.SigningMethodRS256, otherKey, valid()), ErrSignature},
+		{sign(t, jwt.SigningMethodHS256, []byte("secret"), valid()), ErrAlgorithm},
+		{"not.a.token", ErrMalformedToken},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+test.token)
+		assert.Equal(t, test.expected, authenticate(handler, req).Err)
+	}
+
+	handler.Key["spring:ann"] = privateKey
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+sign(t, jwt.SigningMethodRS256, privateKey, elsewhere))
+	assert.Equal(t, ErrIssuer, authenticate(handler, req).Err)
+
+	handler.Skew = 2 * time.Minute
+	for _, claims := range []*jwt.StandardClaims{expired, early, future} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+sign(t, jwt.SigningMethodRS256, privateKey, claims))
+		assert.NoError(t, authenticate(handler, req).Err)
+	}
+}
+
+func TestSessionChoosesAlgorithmFromKey(t *testing.T) {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(t, err)
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	handler := &Handler{Store: Store{Security{
+		Key:    map[string]crypto.Signer{"winter:p256": p256, "winter:p384": p384, "winter:ed": ed},
+		Secret: map[string][]byte{"winter:hmac": []byte("secret")},
+	}}}
+
+	for subject, algorithm := range map[string]string{
+		"p256": "ES256",
+		"p384": "ES384",
+		"ed":   "EdDSA",
+		"hmac": "HS256",
+	} {
+		assert.NoError(t, handler.New(manifest{"winter", subject, time.Now().Add(time.Hour).Unix()}))
+
+		token, err := jwt.Parse(handler.Token(), func(token *jwt.Token) (interface{}, error) {
+			_, signingKey := key(handler, "winter", subject)
+			return verificationKey(signingKey), nil
+		})
+		assert.NoError(t, err, subject)
+		assert.Equal(t, algorithm, token.Method.Alg())
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+handler.Token())
+		assert.NoError(t, authenticate(handler, req).Err, subject)
+	}
+
+	handler.Algorithm = "HS512"
+	assert.NoError(t, handler.New(manifest{"winter", "hmac", 0}))
+	assert.EqualError(t, handler.New(manifest{"winter", "p256", 0}), "winter: unsupported signing algorithm HS512")
+
+	handler.Algorithm = ""
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+sign(t, jwt.SigningMethodES384, p384, &jwt.StandardClaims{Issuer: "winter", Subject: "p256"}))
+	assert.Equal(t, ErrAlgorithm, authenticate(handler, req).Err)
+}
+
+// opaqueSigner hides the concrete type of a key, as the signers of a KMS
+// or an HSM do.
+type opaqueSigner struct {
+	signer crypto.Signer
+}
+
+func (o opaqueSigner) Public() crypto.PublicKey { return o.signer.Public() }
+
+func (o opaqueSigner) Sign(random io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return o.signer.Sign(random, digest, opts)
+}
+
+func TestSessionSignsWithAnySigner(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	p521, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	assert.NoError(t, err)
+
+	handler := &Handler{Store: Store{Security{Key: map[string]crypto.Signer{
+		"winter:rsa":  opaqueSigner{rsaKey},
+		"winter:p256": opaqueSigner{p256},
+		"winter:p521": opaqueSigner{p521},
+	}}}}
+
+	for _, test := range []struct{ subject, algorithm string }{
+		{"rsa", "RS256"}, {"rsa", "RS512"}, {"rsa", "PS256"}, {"rsa", "PS384"},
+		{"p256", "ES256"}, {"p521", "ES512"},
+	} {
+		handler.Algorithm = test.algorithm
+		assert.NoError(t, handler.New(manifest{"winter", test.subject, time.Now().Add(time.Hour).Unix()}), test.algorithm)
+
+		token, err := jwt.Parse(handler.Token(), func(token *jwt.Token) (interface{}, error) {
+			_, signingKey := key(handler, "winter", test.subject)
+			return verificationKey(signingKey), nil
+		})
+		assert.NoError(t, err, test.algorithm)
+		assert.Equal(t, test.algorithm, token.Method.Alg())
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+handler.Token())
+		assert.NoError(t, authenticate(handler, req).Err, test.algorithm)
+	}
+
+	_, err = rsaAlgorithms["RS256"].Sign("header.payload", opaqueSigner{p256})
+	assert.Equal(t, jwt.ErrInvalidKeyType, err)
+}
+
+func TestSigningMethodEdDSA(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	method := jwt.GetSigningMethod("EdDSA")
+	assert.Equal(t, SigningMethodEdDSA, method)
+
+	signature, err := method.Sign("header.payload", private)
+	assert.NoError(t, err)
+	assert.NoError(t, method.Verify("header.payload", signature, public))
+	assert.Equal(t, jwt.ErrSignatureInvalid, method.Verify("header.tampered", signature, public))
+
+	_, err = method.Sign("header.payload", []byte("secret"))
+	assert.Equal(t, jwt.ErrInvalidKeyType, err)
+}
@@ -0,0 +1,198 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"math/big"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// DefaultAlgorithm signs the tokens of a Handler with an RSA key when it
+// declares no Algorithm.
+const DefaultAlgorithm = "RS256"
+
+// SigningMethodEdDSA signs tokens with Ed25519 keys, which jwt-go leaves
+// out. It is registered as the EdDSA algorithm.
+var SigningMethodEdDSA = new(signingMethodEdDSA)
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+type signingMethodEdDSA struct{}
+
+func (method *signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+// Sign takes an ed25519.PrivateKey or any crypto.Signer of an Ed25519 key.
+func (method *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	if _, ok := signer.Public().(ed25519.PublicKey); !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	signature, err := signer.Sign(rand.Reader, []byte(signingString), crypto.Hash(0))
+	if err != nil {
+		return "", err
+	}
+	return jwt.EncodeSegment(signature), nil
+}
+
+func (method *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	decoded, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, []byte(signingString), decoded) {
+		return jwt.ErrSignatureInvalid
+	}
+	return nil
+}
+
+// signingMethodSigner signs with any crypto.Signer of an RSA or ECDSA key,
+// where jwt-go only takes *rsa.PrivateKey and *ecdsa.PrivateKey, and
+// verifies as the method it wraps.
+type signingMethodSigner struct {
+	jwt.SigningMethod
+	hash  crypto.Hash
+	pss   bool
+	curve elliptic.Curve
+}
+
+func (method *signingMethodSigner) Sign(signingString string, key interface{}) (string, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	var opts crypto.SignerOpts = method.hash
+	switch public := signer.Public().(type) {
+	case *rsa.PublicKey:
+		if method.curve != nil {
+			return "", jwt.ErrInvalidKeyType
+		}
+		if method.pss {
+			opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: method.hash}
+		}
+	case *ecdsa.PublicKey:
+		if method.curve == nil || public.Curve != method.curve {
+			return "", jwt.ErrInvalidKeyType
+		}
+	default:
+		return "", jwt.ErrInvalidKeyType
+	}
+	if !method.hash.Available() {
+		return "", jwt.ErrHashUnavailable
+	}
+
+	digest := method.hash.New()
+	digest.Write([]byte(signingString))
+	signature, err := signer.Sign(rand.Reader, digest.Sum(nil), opts)
+	if err != nil {
+		return "", err
+	}
+	if method.curve != nil {
+		if signature, err = concatenate(signature, method.curve); err != nil {
+			return "", err
+		}
+	}
+	return jwt.EncodeSegment(signature), nil
+}
+
+// concatenate turns the ASN.1 signature of a crypto.Signer into the fixed
+// size r || s that JWS expects of ECDSA.
+func concatenate(signature []byte, curve elliptic.Curve) ([]byte, error) {
+	var parsed struct {
+		R, S *big.Int
+	}
+	if rest, err := asn1.Unmarshal(signature, &parsed); err != nil || len(rest) > 0 {
+		return nil, jwt.ErrECDSAVerification
+	}
+	size := (curve.Params().BitSize + 7) / 8
+	if parsed.R.Sign() < 0 || parsed.S.Sign() < 0 || parsed.R.BitLen() > 8*size || parsed.S.BitLen() > 8*size {
+		return nil, jwt.ErrECDSAVerification
+	}
+	concatenated := make([]byte, 2*size)
+	parsed.R.FillBytes(concatenated[:size])
+	parsed.S.FillBytes(concatenated[size:])
+	return concatenated, nil
+}
+
+var (
+	rsaAlgorithms = map[string]jwt.SigningMethod{
+		"RS256": &signingMethodSigner{SigningMethod: jwt.SigningMethodRS256, hash: crypto.SHA256},
+		"RS384": &signingMethodSigner{SigningMethod: jwt.SigningMethodRS384, hash: crypto.SHA384},
+		"RS512": &signingMethodSigner{SigningMethod: jwt.SigningMethodRS512, hash: crypto.SHA512},
+		"PS256": &signingMethodSigner{SigningMethod: jwt.SigningMethodPS256, hash: crypto.SHA256, pss: true},
+		"PS384": &signingMethodSigner{SigningMethod: jwt.SigningMethodPS384, hash: crypto.SHA384, pss: true},
+		"PS512": &signingMethodSigner{SigningMethod: jwt.SigningMethodPS512, hash: crypto.SHA512, pss: true},
+	}
+	hmacAlgorithms = map[string]jwt.SigningMethod{
+		"HS256": jwt.SigningMethodHS256,
+		"HS384": jwt.SigningMethodHS384,
+		"HS512": jwt.SigningMethodHS512,
+	}
+	curveAlgorithms = map[elliptic.Curve]jwt.SigningMethod{
+		elliptic.P256(): &signingMethodSigner{SigningMethod: jwt.SigningMethodES256, hash: crypto.SHA256, curve: elliptic.P256()},
+		elliptic.P384(): &signingMethodSigner{SigningMethod: jwt.SigningMethodES384, hash: crypto.SHA384, curve: elliptic.P384()},
+		elliptic.P521(): &signingMethodSigner{SigningMethod: jwt.SigningMethodES512, hash: crypto.SHA512, curve: elliptic.P521()},
+	}
+)
+
+// algorithms returns the algorithms a key of the Store signs with, the
+// first one being used unless the Handler declares another.
+func algorithms(key interface{}) (string, map[string]jwt.SigningMethod) {
+	switch key := key.(type) {
+	case []byte:
+		return "HS256", hmacAlgorithms
+	case crypto.Signer:
+		switch public := key.Public().(type) {
+		case *rsa.PublicKey:
+			return DefaultAlgorithm, rsaAlgorithms
+		case *ecdsa.PublicKey:
+			if method, ok := curveAlgorithms[public.Curve]; ok {
+				return method.Alg(), map[string]jwt.SigningMethod{method.Alg(): method}
+			}
+		case ed25519.PublicKey:
+			return SigningMethodEdDSA.Alg(), map[string]jwt.SigningMethod{SigningMethodEdDSA.Alg(): SigningMethodEdDSA}
+		}
+	}
+	return "", nil
+}
+
+// verificationKey returns what the signature of a token signed with key is
+// verified against: the public key, or the secret itself.
+func verificationKey(key interface{}) interface{} {
+	if signer, ok := key.(crypto.Signer); ok {
+		return signer.Public()
+	}
+	return key
+}
@@ -0,0 +1,104 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"net"
+	"net/textproto"
+	"net/url"
+)
+
+// The request parts a parameter can be bound to besides path variables and
+// query arguments, as in //> @header X-Request-Id.
+const (
+	headerSource = "header"
+	cookieSource = "cookie"
+	remoteSource = "remote"
+)
+
+// remoteName is the only argument of the arguments returned by Remote.
+const remoteName = "remote"
+
+// Header returns the request headers as arguments, so that the typed
+// accessors convert them as they do path variables. Names have to be in
+// canonical form, as in X-Request-Id.
+func (arguments *Arguments) Header() *Arguments {
+	if arguments.headers == nil {
+		arguments.headers = &Arguments{source: headerSource}
+		if arguments.request != nil {
+			arguments.headers.Query = url.Values(arguments.request.Header)
+		}
+	}
+	return arguments.headers
+}
+
+// Cookie returns the cookies of the request as arguments.
+func (arguments *Arguments) Cookie() *Arguments {
+	if arguments.cookies == nil {
+		arguments.cookies = &Arguments{source: cookieSource}
+		if arguments.request != nil {
+			cookies := arguments.request.Cookies()
+			arguments.cookies.Query = make(url.Values, len(cookies))
+			for _, cookie := range cookies {
+				arguments.cookies.Query.Add(cookie.Name, cookie.Value)
+			}
+		}
+	}
+	return arguments.cookies
+}
+
+// Remote returns the address of the client without its port as the
+// argument named "remote", so that it can be bound to a string, a net.IP
+// or a netip.Addr.
+func (arguments *Arguments) Remote() *Arguments {
+	remote := &Arguments{source: remoteSource}
+	if arguments.request != nil {
+		host, _, err := net.SplitHostPort(arguments.request.RemoteAddr)
+		if err != nil {
+			host = arguments.request.RemoteAddr
+		}
+		remote.Query = url.Values{remoteName: {host}}
+	}
+	return remote
+}
+
+// from returns the arguments a parameter bound to the given source reads.
+func (arguments *Arguments) from(source string) *Arguments {
+	switch source {
+	case headerSource:
+		return arguments.Header()
+	case cookieSource:
+		return arguments.Cookie()
+	case remoteSource:
+		return arguments.Remote()
+	}
+	return arguments
+}
+
+// sourceName resolves the name under which a parameter annotated with
+// @header, @cookie or @remote is read, defaulting to the parameter name.
+func sourceName(source, parameter string, names []string) string {
+	switch {
+	case source == remoteSource:
+		return remoteName
+	case len(names) > 0 && source == headerSource:
+		return textproto.CanonicalMIMEHeaderKey(names[0])
+	case len(names) > 0:
+		return names[0]
+	case source == headerSource:
+		return textproto.CanonicalMIMEHeaderKey(parameter)
+	}
+	return parameter
+}
@@ -15,16 +15,146 @@
 package winter
 
 import (
-	"crypto/rsa"
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rrborja/winter/metadata"
+)
+
+const (
+	DefaultAddress         = ":8080"
+	DefaultShutdownTimeout = 10 * time.Second
 )
 
 type Store struct {
 	Security
 }
 
+// Security holds the keys sessions are signed with, by issuer:subject. Key
+// takes RSA, ECDSA and Ed25519 keys and Secret the secrets of HMAC.
 type Security struct {
-	Key map[string]*rsa.PrivateKey
+	Key    map[string]crypto.Signer
+	Secret map[string][]byte
+}
+
+// Options configures the server started by RunWithOptions. Source is the
+// module root whose packages hold the route annotations of the controllers,
+// and Context the interceptors that wrap every route and the ones routes
+// can declare by name. Panics are answered with an internal server error,
+// showing the stack in Development, and reported to Reporter. Session, when
+// set, is bound to every request to issue its tokens.
+type Options struct {
+	Address         string
+	Source          string
+	BuildTags       []string
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+	Controllers     []Controller
+	Context         *Context
+	Reporter        Reporter
+	Development     bool
+	Session         *Handler
+	JWKS            string
 }
 
-func Run() {
+// loadRoutingTable prefers the routes compiled by `winter gen` and only
+// falls back to reading the annotations from source when none were
+// registered.
+func loadRoutingTable(options Options) (table *routingTable, err error) {
+	if options.JWKS != "" && options.Session == nil {
+		return nil, errors.New("winter: publishing a JWK Set needs a Session")
+	}
+	if compiled := compiledRoutes(); len(compiled) > 0 {
+		table, err = newCompiledRoutingTable(compiled, options.Controllers)
+	} else {
+		source := &metadata.Source{BuildTags: options.BuildTags}
+		if err := source.LoadSourceCode(options.Source); err != nil {
+			return nil, err
+		}
+		table, err = newRoutingTable(&source.GoFileRegistry, options.Controllers)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := table.intercept(options.Context); err != nil {
+		return nil, err
+	}
+	if options.Context != nil {
+		table.exceptions = options.Context.exceptions
+	}
+	table.reporter = options.Reporter
+	table.development = options.Development
+	table.session = options.Session
+	for _, r := range table.routes {
+		if r.guard.auth && options.Session == nil {
+			return nil, fmt.Errorf("%s: @auth needs a Session", r.name)
+		}
+	}
+	if options.JWKS != "" {
+		if err := table.publish(options.JWKS, options.Session.keys()); err != nil {
+			return nil, err
+		}
+	}
+	return table, nil
+}
+
+// Run serves the given controllers on DefaultAddress and blocks until the
+// process is interrupted.
+func Run(controllers ...Controller) error {
+	return RunWithOptions(Options{Controllers: controllers})
+}
+
+func RunWithOptions(options Options) error {
+	if options.Address == "" {
+		options.Address = DefaultAddress
+	}
+	if options.Source == "" {
+		options.Source = "."
+	}
+	if options.ShutdownTimeout == 0 {
+		options.ShutdownTimeout = DefaultShutdownTimeout
+	}
+
+	table, err := loadRoutingTable(options)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:         options.Address,
+		Handler:      table,
+		ReadTimeout:  options.ReadTimeout,
+		WriteTimeout: options.WriteTimeout,
+		IdleTimeout:  options.IdleTimeout,
+	}
+
+	failure := make(chan error, 1)
+	go func() {
+		failure <- server.ListenAndServe()
+	}()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	select {
+	case err := <-failure:
+		return err
+	case <-interrupt:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), options.ShutdownTimeout)
+	defer cancel()
+
+	return server.Shutdown(ctx)
 }
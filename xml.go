@@ -0,0 +1,158 @@
+// Copyright 2017 Ritchie Borja
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package winter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+var xmlUnmarshalerType = reflect.TypeOf((*xml.Unmarshaler)(nil)).Elem()
+
+// decodeXML decodes an XML body into target. encoding/xml has nothing like
+// DisallowUnknownFields, so a strict route reads the body a second time as
+// a tree of elements and checks it against the fields of the target.
+func decodeXML(body io.Reader, target interface{}, strict bool) error {
+	if !strict {
+		return xml.NewDecoder(body).Decode(target)
+	}
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(content, target); err != nil {
+		return err
+	}
+	var root xmlElement
+	if err := xml.Unmarshal(content, &root); err != nil {
+		return err
+	}
+	return root.check(reflect.TypeOf(target))
+}
+
+type xmlElement struct {
+	XMLName    xml.Name
+	Attributes []xml.Attr   `xml:",any,attr"`
+	Children   []xmlElement `xml:",any"`
+}
+
+// xmlFields are the child elements and attributes a struct declares, by
+// their local name. A nil element type is not checked any further.
+type xmlFields struct {
+	elements     map[string]reflect.Type
+	attributes   map[string]bool
+	anyElement   bool
+	anyAttribute bool
+}
+
+// check rejects the attributes and child elements that typ does not
+// declare, down to the types that unmarshal themselves.
+func (element *xmlElement) check(typ reflect.Type) error {
+	for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice && typ.Elem().Kind() != reflect.Uint8 {
+		typ = typ.Elem()
+	}
+	if reflect.PtrTo(typ).Implements(xmlUnmarshalerType) || reflect.PtrTo(typ).Implements(textUnmarshalerType) {
+		return nil
+	}
+
+	fields := xmlFields{elements: make(map[string]reflect.Type), attributes: make(map[string]bool)}
+	if typ.Kind() == reflect.Struct {
+		fields.add(typ)
+	}
+
+	if !fields.anyAttribute {
+		for _, attribute := range element.Attributes {
+			if attribute.Name.Space == "xmlns" || attribute.Name.Space == "" && attribute.Name.Local == "xmlns" {
+				continue
+			}
+			if !fields.attributes[attribute.Name.Local] {
+				return fmt.Errorf("unknown attribute %q of <%s>", attribute.Name.Local, element.XMLName.Local)
+			}
+		}
+	}
+	if fields.anyElement {
+		return nil
+	}
+	for i := range element.Children {
+		child := &element.Children[i]
+		childType, ok := fields.elements[child.XMLName.Local]
+		if !ok {
+			return fmt.Errorf("unknown element <%s> in <%s>", child.XMLName.Local, element.XMLName.Local)
+		}
+		if childType == nil {
+			continue
+		}
+		if err := child.check(childType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add reads the fields of a struct the way encoding/xml does, including
+// the ones of embedded structs.
+func (fields *xmlFields) add(typ reflect.Type) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("xml")
+		if tag == "-" || field.Name == "XMLName" || field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		if field.Anonymous && tag == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				fields.add(embedded)
+				continue
+			}
+		}
+
+		name, flags := tag, ""
+		if comma := strings.IndexByte(tag, ','); comma >= 0 {
+			name, flags = tag[:comma], tag[comma:]
+		}
+		if space := strings.LastIndexByte(name, ' '); space >= 0 {
+			name = name[space+1:]
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		switch {
+		case strings.Contains(flags, ",attr"):
+			if strings.Contains(flags, ",any") {
+				fields.anyAttribute = true
+			} else {
+				fields.attributes[name] = true
+			}
+		case strings.Contains(flags, ",innerxml"), strings.Contains(flags, ",any"):
+			fields.anyElement = true
+		case strings.Contains(flags, ",chardata"), strings.Contains(flags, ",cdata"), strings.Contains(flags, ",comment"):
+		case strings.Contains(name, ">"):
+			// A path such as a>b only has its first element checked.
+			parent := name[:strings.IndexByte(name, '>')]
+			if _, ok := fields.elements[parent]; !ok {
+				fields.elements[parent] = nil
+			}
+		default:
+			fields.elements[name] = field.Type
+		}
+	}
+}